@@ -0,0 +1,306 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"github.com/platinasystems/goes-bmc/cmd/board"
+	"github.com/platinasystems/log"
+)
+
+func init() { board.Default = boards }
+
+// currentBoard returns the description of this board for a daemon's Init,
+// or nil, having logged why as an error, if there isn't one. A bmc whose
+// eeprom can't be read gets the tor1 description, as before boards were
+// described.
+func currentBoard() *board.Board {
+	b, err := board.Current()
+	if err != nil {
+		log.Print("daemon", "err", "board: ", err,
+			"; its daemons are idle")
+		return nil
+	}
+	return b
+}
+
+// boards describes the platina-mk1-bmc variants. Prototypes, with eeprom
+// device version 0x00 or 0xff, have the ucd9090 at 0x7e and the front
+// panel led expander at 0x22, with its LEDs on other bits; their fan tray
+// LEDs swap green and yellow, and their front panel button may switch the
+// console.
+//
+// On the CH1 main card the ucd9090 is at 0x7e on channel 1 of main_mux0,
+// 0x71 on bus 0. diag reaches it by setting the mux, so ucd9090d does the
+// same. Its rails are those of TOR1, which diag checks on the main card.
+// The power supplies and fans belong to the chassis, so the other TOR1
+// daemons have nothing to do there.
+//
+// The CH1 line card isn't supported. Only the monitor pins and eeprom that
+// diag checks on every CH1 bmc are described, so its daemons stay idle and
+// its power diag fails rather than passing with nothing checked.
+const boards = `{
+	"Default": "tor1",
+	"Boards": [
+		{
+			"Name": "tor1",
+			"Match": {
+				"Chassis": [0],
+				"Board": [0]
+			},
+			"Fantrayd": {
+				"Bus": 14,
+				"Addr": 32,
+				"GpioIntL": "FAN_STATUS_INT_L",
+				"Keys": {
+					"fan_tray.1.status": 1,
+					"fan_tray.2.status": 2,
+					"fan_tray.3.status": 3,
+					"fan_tray.4.status": 4
+				},
+				"Leds": [
+					{"Mask": 48, "Green": 32, "Yellow": 16},
+					{"Mask": 3, "Green": 2, "Yellow": 1},
+					{"Mask": 48, "Green": 32, "Yellow": 16},
+					{"Mask": 3, "Green": 2, "Yellow": 1}
+				]
+			},
+			"Fspd": {
+				"Psu": [
+					{
+						"Slot": 2,
+						"Bus": 12,
+						"Addr": 88,
+						"AddrProm": 80,
+						"GpioPwrok": "PSU0_PWROK",
+						"GpioPrsntL": "PSU0_PRSNT_L",
+						"GpioPwronL": "PSU0_PWRON_L",
+						"GpioIntL": "PSU0_INT_L"
+					},
+					{
+						"Slot": 1,
+						"Bus": 13,
+						"Addr": 88,
+						"AddrProm": 80,
+						"GpioPwrok": "PSU1_PWROK",
+						"GpioPrsntL": "PSU1_PRSNT_L",
+						"GpioPwronL": "PSU1_PWRON_L",
+						"GpioIntL": "PSU1_INT_L"
+					}
+				],
+				"Keys": {
+					"psu1.eeprom": 1,
+					"psu1.fan_speed.units.rpm": 1,
+					"psu1.status": 1,
+					"psu1.admin.state": 1,
+					"psu1.mfg_id": 1,
+					"psu1.mfg_model": 1,
+					"psu1.i_out.units.A": 1,
+					"psu1.v_in.units.V": 1,
+					"psu1.v_out.units.V": 1,
+					"psu1.p_out.units.W": 1,
+					"psu1.p_in.units.W": 1,
+					"psu1.temp1.units.C": 1,
+					"psu1.temp2.units.C": 1,
+					"psu1.fan_direction": 1,
+					"psu1.sn": 1,
+					"psu2.eeprom": 0,
+					"psu2.fan_speed.units.rpm": 0,
+					"psu2.status": 0,
+					"psu2.admin.state": 0,
+					"psu2.mfg_id": 0,
+					"psu2.mfg_model": 0,
+					"psu2.i_out.units.A": 0,
+					"psu2.v_in.units.V": 0,
+					"psu2.v_out.units.V": 0,
+					"psu2.p_out.units.W": 0,
+					"psu2.p_in.units.W": 0,
+					"psu2.temp1.units.C": 0,
+					"psu2.temp2.units.C": 0,
+					"psu2.fan_direction": 0,
+					"psu2.sn": 0
+				}
+			},
+			"Ledgpiod": {
+				"Bus": 5,
+				"Addr": 117,
+				"Keys": {
+					"system.fan_direction": 0
+				},
+				"System": {
+					"Mask": 1,
+					"Green": 1,
+					"Yellow": 12,
+					"Off": 128
+				},
+				"Fan": {
+					"Mask": 6,
+					"Green": 2,
+					"Yellow": 6,
+					"Off": 0
+				},
+				"Psu": [
+					{"Mask": 8, "Yellow": 8, "Off": 4},
+					{"Mask": 16, "Yellow": 16, "Off": 1}
+				]
+			},
+			"Ucd9090d": {
+				"Bus": 4,
+				"Addr": 52,
+				"Keys": {
+					"vmon.5v.sb.units.V": 1,
+					"vmon.3v8.bmc.units.V": 2,
+					"vmon.3v3.sys.units.V": 3,
+					"vmon.3v3.bmc.units.V": 4,
+					"vmon.3v3.sb.units.V": 5,
+					"vmon.1v0.thc.units.V": 6,
+					"vmon.1v8.sys.units.V": 7,
+					"vmon.1v25.sys.units.V": 8,
+					"vmon.1v2.ethx.units.V": 9,
+					"vmon.1v0.tha.units.V": 10,
+					"vmon.poweroff.events": 0
+				},
+				"Rails": [
+					"P5V_SB",
+					"P3V8_BMC",
+					"P3V3_SB",
+					"PERI_3V3",
+					"P3V3",
+					"VDD_CORE",
+					"P1V8",
+					"P1V25",
+					"P1V2",
+					"P1V0"
+				]
+			},
+			"W83795d": {
+				"Bus": 11,
+				"Addr": 47,
+				"Keys": {
+					"fan_tray.1.1.speed.units.rpm": 1,
+					"fan_tray.1.2.speed.units.rpm": 2,
+					"fan_tray.2.1.speed.units.rpm": 3,
+					"fan_tray.2.2.speed.units.rpm": 4,
+					"fan_tray.3.1.speed.units.rpm": 5,
+					"fan_tray.3.2.speed.units.rpm": 6,
+					"fan_tray.4.1.speed.units.rpm": 7,
+					"fan_tray.4.2.speed.units.rpm": 8,
+					"fan_tray.speed": 0,
+					"fan_tray.duty": 0,
+					"hwmon.front.temp.units.C": 0,
+					"hwmon.rear.temp.units.C": 0,
+					"hwmon.target.units.C": 0,
+					"host.temp.units.C": 0,
+					"host.temp.target.units.C": 0,
+					"qsfp.temp.units.C": 0,
+					"qsfp.temp.target.units.C": 0
+				}
+			},
+			"Sold": {
+				"Tty": "/dev/ttymxc1"
+			}
+		},
+		{
+			"Name": "tor1-proto",
+			"Inherit": "tor1",
+			"Match": {
+				"Chassis": [0],
+				"Board": [0],
+				"Version": [0, 255]
+			},
+			"Fantrayd": {
+				"Leds": [
+					{"Mask": 48, "Green": 16, "Yellow": 32},
+					{"Mask": 3, "Green": 1, "Yellow": 2},
+					{"Mask": 48, "Green": 16, "Yellow": 32},
+					{"Mask": 3, "Green": 1, "Yellow": 2}
+				]
+			},
+			"Ledgpiod": {
+				"Addr": 34,
+				"System": {
+					"Mask": 192,
+					"Green": 0,
+					"Yellow": 12,
+					"Off": 128
+				},
+				"Fan": {
+					"Mask": 48,
+					"Green": 16,
+					"Yellow": 32,
+					"Off": 48
+				},
+				"Psu": [
+					{"Mask": 12, "Yellow": 0, "Off": 4},
+					{"Mask": 3, "Yellow": 0, "Off": 1}
+				]
+			},
+			"Ucd9090d": {
+				"Addr": 126
+			},
+			"ConsoleButton": true
+		},
+		{
+			"Name": "ch1-mc",
+			"Match": {
+				"Chassis": [1, 2, 3],
+				"Board": [4]
+			},
+			"Ucd9090d": {
+				"Bus": 0,
+				"Mux": 113,
+				"Channel": 1,
+				"Addr": 126,
+				"Keys": {
+					"vmon.5v.sb.units.V": 1,
+					"vmon.3v8.bmc.units.V": 2,
+					"vmon.3v3.sys.units.V": 3,
+					"vmon.3v3.bmc.units.V": 4,
+					"vmon.3v3.sb.units.V": 5,
+					"vmon.1v0.thc.units.V": 6,
+					"vmon.1v8.sys.units.V": 7,
+					"vmon.1v25.sys.units.V": 8,
+					"vmon.1v2.ethx.units.V": 9,
+					"vmon.1v0.tha.units.V": 10,
+					"vmon.poweroff.events": 0
+				},
+				"Rails": [
+					"P5V_SB",
+					"P3V8_BMC",
+					"P3V3_SB",
+					"PERI_3V3",
+					"P3V3",
+					"VDD_CORE",
+					"P1V8",
+					"P1V25",
+					"P1V2",
+					"P1V0"
+				]
+			}
+		},
+		{
+			"Name": "ch1-lc",
+			"Match": {
+				"Chassis": [1, 2, 3],
+				"Board": [5]
+			},
+			"Diag": {
+				"MonPins": [
+					"BMC_I2C0_SCL_MON",
+					"BMC_I2C0_SDA_MON",
+					"BMC_I2C1_SCL_MON",
+					"BMC_I2C1_SDA_MON"
+				],
+				"I2c": [
+					{
+						"Name": "eeprom",
+						"Bus": 0,
+						"Addr": 85
+					}
+				]
+			}
+		}
+	]
+}
+`
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/platinasystems/goes-bmc/cmd/board"
+)
+
+func TestBoards(t *testing.T) {
+	board.File = filepath.Join(t.Name(), "none")
+	for _, x := range []struct {
+		id   board.ID
+		name string
+		ucd  int
+		psus int
+		tty  string
+	}{
+		{board.ID{Chassis: 0, Board: 0, Version: 2}, "tor1", 0x34, 2,
+			"/dev/ttymxc1"},
+		{board.ID{Chassis: 0, Board: 0, Version: 0xff}, "tor1-proto", 0x7e,
+			2, "/dev/ttymxc1"},
+		{board.ID{Chassis: 1, Board: 4, Version: 1}, "ch1-mc", 0x7e, 0, ""},
+		{board.ID{Chassis: 3, Board: 4, Version: 1}, "ch1-mc", 0x7e, 0, ""},
+		{board.ID{Chassis: 2, Board: 5, Version: 1}, "ch1-lc", 0, 0, ""},
+		{board.ID{Chassis: board.Unknown, Board: board.Unknown,
+			Version: 2}, "tor1", 0x34, 2, "/dev/ttymxc1"},
+	} {
+		b, err := board.Select(x.id)
+		if err != nil {
+			t.Fatal(x.id, err)
+		}
+		if b.Name != x.name || b.Ucd9090d.Addr != x.ucd ||
+			len(b.Fspd.Psu) != x.psus || b.Sold.Tty != x.tty {
+			t.Errorf("%v: got %s ucd 0x%x %d psus tty %q", x.id,
+				b.Name, b.Ucd9090d.Addr, len(b.Fspd.Psu), b.Sold.Tty)
+		}
+	}
+
+	// the CH1 main card's ucd9090 is on channel 1 of main_mux0
+	b, err := board.Select(board.ID{Chassis: 1, Board: 4, Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := b.Ucd9090d; u.Bus != 0 || u.Mux != 0x71 || u.MuxValue() != 2 ||
+		len(u.Rails) != 10 {
+		t.Errorf("ch1-mc ucd9090: %+v", u)
+	}
+
+	// an unknown board gets nothing rather than the TOR1 devices
+	id := board.ID{Chassis: 1, Board: 7, Version: 1}
+	if b, err := board.Select(id); err == nil {
+		t.Errorf("%v: got %s", id, b.Name)
+	}
+}
+
+func TestBoardLeds(t *testing.T) {
+	board.File = filepath.Join(t.Name(), "none")
+	for _, x := range []struct {
+		version int
+		sys     board.Led
+		tray    board.Led
+		button  bool
+	}{
+		{2, board.Led{Mask: 0x01, Green: 0x01, Yellow: 0x0c, Off: 0x80},
+			board.Led{Mask: 0x30, Green: 0x20, Yellow: 0x10}, false},
+		{0xff, board.Led{Mask: 0xc0, Green: 0x00, Yellow: 0x0c, Off: 0x80},
+			board.Led{Mask: 0x30, Green: 0x10, Yellow: 0x20}, true},
+	} {
+		b, err := board.Select(board.ID{Version: x.version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Ledgpiod.System != x.sys || len(b.Fantrayd.Leds) != 4 ||
+			b.Fantrayd.Leds[0] != x.tray || len(b.Ledgpiod.Psu) != 2 ||
+			b.ConsoleButton != x.button {
+			t.Errorf("%s: got %+v %+v %v", b.Name, b.Ledgpiod,
+				b.Fantrayd.Leds, b.ConsoleButton)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package board selects the description of the BMC's board, its i2c
+// devices, gpios and published keys, by the chassis type, board type and
+// device version of the ONIE eeprom.
+//
+// Descriptions are read from File, if present, otherwise from Default.
+// Each board may inherit another, overriding only what differs. Fields of
+// objects override one by one, but a list or map of keys replaces the
+// inherited one whole, so a board can drop an inherited key or LED, e.g.
+//
+//	{
+//		"Default": "tor1",
+//		"Boards": [
+//			{"Name": "tor1", "Match": {"Chassis": [0], "Board": [0]},
+//			 "Ucd9090d": {"Bus": 4, "Addr": 52}, ...},
+//			{"Name": "tor1-proto", "Inherit": "tor1",
+//			 "Match": {"Chassis": [0], "Board": [0],
+//				"Version": [0, 255]},
+//			 "Ucd9090d": {"Addr": 126}}
+//		]
+//	}
+//
+// The board that matches the most fields is selected. If the eeprom can't
+// be read, so that neither chassis nor board type is known, the
+// description's Default board is, with a warning. A board that identifies
+// itself but isn't described gets none, so that no daemon pokes the devices
+// of another board.
+package board
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/platinasystems/eeprom"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/log"
+)
+
+var (
+	File = "/etc/goes/machine.json"
+
+	// Default is the machine's built-in description.
+	Default string
+)
+
+// Unknown is an ID field that couldn't be read.
+const Unknown = -1
+
+// ID identifies the board as described by its eeprom.
+type ID struct {
+	Chassis int
+	Board   int
+	Version int
+}
+
+func (id ID) String() string {
+	f := func(i int) string {
+		if i == Unknown {
+			return "unknown"
+		}
+		return "0x" + strconv.FormatInt(int64(i), 16)
+	}
+	return fmt.Sprint("chassis ", f(id.Chassis), " board ", f(id.Board),
+		" version ", f(id.Version))
+}
+
+// Match lists the ID fields of a board; an empty list matches any.
+type Match struct {
+	Chassis []int `json:",omitempty"`
+	Board   []int `json:",omitempty"`
+	Version []int `json:",omitempty"`
+}
+
+// Device is an i2c device, the gpio it interrupts on, if any, and, for its
+// daemon, the keys that it publishes. If Mux isn't zero, the device is
+// behind that mux on Bus, which its daemon sets to Channel first.
+type Device struct {
+	Bus      int
+	Mux      int `json:",omitempty"`
+	Channel  int `json:",omitempty"`
+	Addr     int
+	GpioIntL string           `json:",omitempty"`
+	Keys     map[string]uint8 `json:",omitempty"`
+}
+
+// MuxValue is what selects the device's Channel of its Mux.
+func (d *Device) MuxValue() int {
+	if d.Mux == 0 {
+		return 0
+	}
+	return 1 << uint(d.Channel)
+}
+
+// Led is an LED on a gpio expander: the Mask of its output bits and their
+// value for each color.
+type Led struct {
+	Mask   uint8
+	Green  uint8 `json:",omitempty"`
+	Yellow uint8 `json:",omitempty"`
+	Off    uint8 `json:",omitempty"`
+}
+
+// Ledgpiod is the front panel LED expander. The supplies drive their LEDs
+// green themselves.
+type Ledgpiod struct {
+	Device
+	System Led
+	Fan    Led
+	Psu    []Led `json:",omitempty"`
+}
+
+// Fantrayd is the fan tray expander and the LED of each tray.
+type Fantrayd struct {
+	Device
+	Leds []Led `json:",omitempty"`
+}
+
+// Ucd9090d is the power sequencer and the name of each of its rails, by
+// page from 0, as its fault log gives them.
+type Ucd9090d struct {
+	Device
+	Rails []string `json:",omitempty"`
+}
+
+// Sold is the bmc uart wired to the host console.
+type Sold struct {
+	Tty string `json:",omitempty"`
+}
+
+// Psu is a power supply slot.
+type Psu struct {
+	Slot       int
+	Bus        int
+	Addr       int
+	AddrProm   int
+	GpioPwrok  string
+	GpioPrsntL string
+	GpioPwronL string
+	GpioIntL   string
+
+	// Blackbox is the manufacturer specific PMBus command that reads
+	// the supply's fault record, if it has one.
+	Blackbox int `json:",omitempty"`
+}
+
+type Fspd struct {
+	Psu  []Psu
+	Keys map[string]uint8 `json:",omitempty"`
+}
+
+// Ping is an i2c device that diag expects to answer. If Mux isn't zero,
+// the device is behind that mux on Bus, which is set to Channel first.
+type Ping struct {
+	Name    string
+	Bus     int
+	Mux     int `json:",omitempty"`
+	Channel int `json:",omitempty"`
+	Addr    int
+	Word    bool `json:",omitempty"`
+}
+
+// Rail is a ucd9090 monitored voltage and its limits.
+type Rail struct {
+	Name     string
+	Page     uint8
+	Min, Max float64
+}
+
+// Diag lists what diag checks on boards without a dedicated suite.
+type Diag struct {
+	MonPins []string `json:",omitempty"`
+	I2c     []Ping   `json:",omitempty"`
+	Rails   []Rail   `json:",omitempty"`
+}
+
+// Board describes the devices of a board. A daemon whose device has no
+// address, or no keys, has nothing to do on the board.
+type Board struct {
+	Name    string
+	Inherit string `json:",omitempty"`
+	Match   Match
+
+	Fantrayd Fantrayd
+	Fspd     Fspd
+	Ledgpiod Ledgpiod
+	Ucd9090d Ucd9090d
+	W83795d  Device
+	Sold     Sold
+
+	// ConsoleButton enables the front panel button that switches the
+	// console port between the bmc and the host.
+	ConsoleButton bool `json:",omitempty"`
+
+	Diag Diag
+}
+
+type description struct {
+	Default string
+	Boards  []json.RawMessage
+}
+
+// header is what's needed to select a board before resolving inheritance.
+type header struct {
+	Name    string
+	Inherit string
+	Match   Match
+}
+
+func parse(b []byte) (*description, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("no machine description")
+	}
+	desc := new(description)
+	if err := json.Unmarshal(b, desc); err != nil {
+		return nil, err
+	}
+	return desc, nil
+}
+
+// Identify reads the board's ID from the eeprom, falling back to the
+// device version published by redisd.
+func Identify() ID {
+	id := ID{Unknown, Unknown, Unknown}
+	d := eeprom.Device{
+		BusIndex:   0,
+		BusAddress: 0x55,
+	}
+	if err := d.GetInfo(); err == nil {
+		id.Chassis = int(d.Fields.ChassisType)
+		id.Board = int(d.Fields.BoardType)
+		id.Version = int(d.Fields.DeviceVersion)
+		return id
+	}
+	s, err := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
+	if err == nil {
+		if _, err = fmt.Sscan(s, &id.Version); err != nil {
+			id.Version = Unknown
+		}
+	}
+	return id
+}
+
+// Current returns the description of this board.
+func Current() (*Board, error) {
+	return Select(Identify())
+}
+
+// Select returns the description of the board with the given ID. If File
+// can't be used, it logs why and selects from the Default descriptions.
+func Select(id ID) (*Board, error) {
+	b, err := ioutil.ReadFile(File)
+	if os.IsNotExist(err) {
+		return selectFrom([]byte(Default), id)
+	}
+	if err == nil {
+		var board *Board
+		if board, err = selectFrom(b, id); err == nil {
+			return board, nil
+		}
+	}
+	log.Print("warning: ", File, ": ", err, "; using built-in")
+	return selectFrom([]byte(Default), id)
+}
+
+func selectFrom(b []byte, id ID) (*Board, error) {
+	desc, err := parse(b)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := desc.headers()
+	if err != nil {
+		return nil, err
+	}
+	best, score := -1, -1
+	for i, h := range headers {
+		if n, ok := h.Match.score(id); ok && n > score {
+			best, score = i, n
+		}
+	}
+	if best < 0 && id.Chassis == Unknown && id.Board == Unknown {
+		if best = find(headers, desc.Default); best >= 0 {
+			log.Print("warning: no board for ", id, "; using ",
+				desc.Default)
+		}
+	}
+	if best < 0 {
+		return nil, fmt.Errorf("no board for %v", id)
+	}
+	return desc.resolve(headers, best)
+}
+
+func (desc *description) headers() ([]header, error) {
+	headers := make([]header, len(desc.Boards))
+	for i, raw := range desc.Boards {
+		if err := json.Unmarshal(raw, &headers[i]); err != nil {
+			return nil, fmt.Errorf("board %d: %v", i, err)
+		}
+		if headers[i].Name == "" {
+			return nil, fmt.Errorf("board %d: no name", i)
+		}
+	}
+	return headers, nil
+}
+
+func find(headers []header, name string) int {
+	for i, h := range headers {
+		if h.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolve applies the chain of inherited descriptions, oldest ancestor
+// first, then those of board i.
+func (desc *description) resolve(headers []header, i int) (*Board, error) {
+	var chain []int
+	for j := i; ; {
+		for _, k := range chain {
+			if k == j {
+				return nil, fmt.Errorf("%s: inherits itself",
+					headers[i].Name)
+			}
+		}
+		chain = append(chain, j)
+		if headers[j].Inherit == "" {
+			break
+		}
+		parent := find(headers, headers[j].Inherit)
+		if parent < 0 {
+			return nil, fmt.Errorf("%s: %s: not found",
+				headers[j].Name, headers[j].Inherit)
+		}
+		j = parent
+	}
+	b := new(Board)
+	for k := len(chain) - 1; k >= 0; k-- {
+		raw := desc.Boards[chain[k]]
+		clearReplaced(reflect.ValueOf(b).Elem(), raw)
+		if err := json.Unmarshal(raw, b); err != nil {
+			return nil, fmt.Errorf("%s: %v", headers[chain[k]].Name,
+				err)
+		}
+	}
+	b.Name = headers[i].Name
+	b.Inherit = headers[i].Inherit
+	b.Match = headers[i].Match
+	return b, nil
+}
+
+// clearReplaced zeroes the lists and maps of the struct v that raw, its
+// JSON, overrides, since Unmarshal would otherwise merge into them. Objects
+// are followed so that their other fields stay inherited.
+func clearReplaced(v reflect.Value, raw []byte) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			clearReplaced(v.Field(i), raw)
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag != "" {
+			name = tag
+		}
+		for k, sub := range fields {
+			if !strings.EqualFold(k, name) {
+				continue
+			}
+			switch f.Type.Kind() {
+			case reflect.Map, reflect.Slice:
+				v.Field(i).Set(reflect.Zero(f.Type))
+			case reflect.Struct:
+				clearReplaced(v.Field(i), sub)
+			}
+		}
+	}
+}
+
+// score returns the number of fields that m restricts if id satisfies all
+// of them; an unknown field satisfies none.
+func (m *Match) score(id ID) (int, bool) {
+	n := 0
+	for _, f := range []struct {
+		list []int
+		v    int
+	}{
+		{m.Chassis, id.Chassis},
+		{m.Board, id.Board},
+		{m.Version, id.Version},
+	} {
+		if len(f.list) == 0 {
+			continue
+		}
+		found := false
+		for _, v := range f.list {
+			if v == f.v && f.v != Unknown {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		n++
+	}
+	return n, true
+}
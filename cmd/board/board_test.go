@@ -0,0 +1,87 @@
+package board
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDesc = `{
+	"Default": "a",
+	"Boards": [
+		{"Name": "a", "Match": {"Chassis": [0], "Board": [0]},
+		 "Ucd9090d": {"Bus": 4, "Addr": 52, "Keys": {"x": 1}},
+		 "Ledgpiod": {"Bus": 5, "Addr": 117},
+		 "Fantrayd": {"Leds": [{"Mask": 48, "Green": 32},
+			{"Mask": 3, "Green": 2}]}},
+		{"Name": "a-proto", "Inherit": "a",
+		 "Match": {"Chassis": [0], "Board": [0], "Version": [0, 255]},
+		 "Ucd9090d": {"Addr": 126, "Keys": {"y": 2}},
+		 "Fantrayd": {"Leds": [{"Mask": 12}]}},
+		{"Name": "b", "Inherit": "a", "Match": {"Chassis": [1]},
+		 "Ledgpiod": {"Addr": 34}}
+	]
+}`
+
+func TestSelect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "board")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	File = filepath.Join(dir, "machine.json")
+	Default = testDesc
+
+	for _, x := range []struct {
+		id   ID
+		name string
+		ucd  int
+		led  int
+	}{
+		{ID{0, 0, 2}, "a", 52, 117},
+		{ID{0, 0, 0xff}, "a-proto", 126, 117},
+		{ID{0, 0, Unknown}, "a", 52, 117},
+		{ID{1, 5, 1}, "b", 52, 34},
+		{ID{Unknown, Unknown, Unknown}, "a", 52, 117},
+	} {
+		b, err := Select(x.id)
+		if err != nil {
+			t.Fatal(x.id, err)
+		}
+		if b.Name != x.name || b.Ucd9090d.Addr != x.ucd ||
+			b.Ledgpiod.Addr != x.led || b.Ucd9090d.Bus != 4 {
+			t.Errorf("%v: got %s %+v %+v", x.id, b.Name,
+				b.Ucd9090d, b.Ledgpiod)
+		}
+		// lists and maps replace those inherited
+		if x.name == "a-proto" && (len(b.Ucd9090d.Keys) != 1 ||
+			len(b.Fantrayd.Leds) != 1 ||
+			b.Fantrayd.Leds[0] != (Led{Mask: 12})) {
+			t.Error("inherited keys or leds merged:",
+				b.Ucd9090d.Keys, b.Fantrayd.Leds)
+		}
+	}
+
+	// an identified board that isn't described gets none
+	if b, err := Select(ID{2, 0, 1}); err == nil {
+		t.Error("undescribed board got", b.Name)
+	}
+
+	// File replaces Default
+	err = ioutil.WriteFile(File, []byte(`{"Boards": [{"Name": "c",
+		"Ucd9090d": {"Bus": 9}}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := Select(ID{0, 0, 0}); err != nil || b.Name != "c" {
+		t.Error("file not used:", b, err)
+	}
+
+	// a bad file falls back to Default
+	ioutil.WriteFile(File, []byte(`{"Boards": [{"Name": "d",
+		"Inherit": "d"}]}`), 0644)
+	if b, err := Select(ID{0, 0, 0}); err != nil || b.Name != "a-proto" {
+		t.Error("no fallback:", b, err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package board
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/platinasystems/flags"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "board" }
+
+func (Command) Usage() string { return "show board [-json]" }
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "print the selected board description",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Print the eeprom identity of the board and the name of the
+	description selected for it from /etc/goes/machine.json, or
+	the built-in descriptions if that file doesn't exist.
+
+	The -json flag prints the selected description, with inherited
+	values resolved, in the form of that file.`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-json")
+	if len(args) > 0 {
+		return fmt.Errorf("%v: unexpected", args)
+	}
+	id := Identify()
+	b, err := Select(id)
+	if err != nil {
+		return err
+	}
+	if !flag.ByName["-json"] {
+		fmt.Println(b.Name+":", id)
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(b)
+}
@@ -0,0 +1,75 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package console
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/platinasystems/goes-bmc/cmd/consoled"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "console" }
+
+func (Command) Usage() string { return "console [bmc [SECONDS]|host|status]" }
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "switch the console port between the bmc and host",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	The console command gives the front panel console port to the bmc
+	or the host, or, with status or no argument, prints which has it,
+	console.owner.
+
+	With SECONDS, the bmc has the port for that long, then consoled
+	returns it to the host.
+
+	While the bmc has the port, the front panel button can't switch it.`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	if len(args) == 0 || args[0] == "status" {
+		if len(args) > 1 {
+			return fmt.Errorf("%v: unexpected", args[1:])
+		}
+		s, err := redis.Hget(redis.DefaultHash, "console.owner")
+		if err != nil {
+			return err
+		}
+		fmt.Println(s)
+		return nil
+	}
+	owner := args[0]
+	seconds := "0"
+	switch {
+	case len(args) == 2 && owner == consoled.Bmc:
+		if _, err := strconv.ParseUint(args[1], 10, 32); err != nil {
+			return fmt.Errorf("%s: invalid SECONDS", args[1])
+		}
+		seconds = args[1]
+	case len(args) > 1:
+		return fmt.Errorf("%v: unexpected", args[1:])
+	case owner != consoled.Bmc && owner != consoled.Host:
+		return fmt.Errorf("%s: unknown", owner)
+	}
+	_, err := redis.Hset(redis.DefaultHash, "console.return.units.seconds",
+		seconds)
+	if err != nil {
+		return err
+	}
+	_, err = redis.Hset(redis.DefaultHash, "console.owner", owner)
+	return err
+}
@@ -0,0 +1,263 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package consoled owns the mux that connects the front panel console port
+// to the bmc or the host. It publishes console.owner and returns the
+// console to the host when console.return.units.seconds runs out.
+package consoled
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/redis/rpc/args"
+	"github.com/platinasystems/goes/external/redis/rpc/reply"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/gpio"
+	"github.com/platinasystems/i2c"
+)
+
+// Owners of the console port.
+const (
+	Bmc  = "bmc"
+	Host = "host"
+)
+
+var Owners = []string{Bmc, Host}
+
+// GpioButtonEnL enables the front panel button that switches the console.
+// Button is whether the board's description has it enabled.
+var (
+	GpioButtonEnL = "FP_BTN_UARTSEL_EN_L"
+	Button        bool
+)
+
+// The mux select is bit 5 of port 0 of the gpio expander. Driven high it
+// gives the port to the bmc; released, the expander's reset state, to the
+// host.
+const (
+	i2cBus      = 0
+	i2cGpioAddr = 0x74
+	uartSel     = 0x20
+
+	regOutput = 2
+	regConfig = 6
+)
+
+var command *Command
+
+func init() {
+	daemon.Writable("consoled",
+		daemon.Key{
+			Name:   "console.owner",
+			Type:   daemon.EnumKey,
+			Values: Owners,
+			Set: func(v interface{}) error {
+				return command.set(v.(string))
+			},
+		},
+		daemon.Key{
+			Name: "console.return.units.seconds",
+			Type: daemon.IntKey,
+			Max:  24 * 60 * 60,
+			Set: func(v interface{}) error {
+				command.returnAfter = time.Duration(v.(int64)) *
+					time.Second
+				return nil
+			},
+		},
+	)
+}
+
+type Command struct {
+	Info
+	Init func()
+	init sync.Once
+
+	returnAfter time.Duration
+	returnAt    time.Time
+}
+
+type Info struct {
+	mutex sync.Mutex
+	d     *daemon.Daemon
+}
+
+func (*Command) String() string { return "consoled" }
+
+func (*Command) Usage() string { return "consoled" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "console mux daemon, publishes to redis",
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(...string) error {
+	command = c
+	if c.Init != nil {
+		c.init.Do(c.Init)
+	}
+
+	c.d = daemon.New("consoled")
+	if err := c.d.Start(&c.Info); err != nil {
+		return err
+	}
+
+	return c.d.Run(daemon.Ticker{
+		Name:     "update",
+		Interval: time.Second,
+		Func:     c.update,
+	})
+}
+
+// update publishes the owner that the mux select says and returns the
+// console to the host when it's due. It leaves the mux alone while i2cd
+// has stopped polling.
+func (c *Command) update() error {
+	if daemon.Stopped() {
+		return nil
+	}
+	if !c.returnAt.IsZero() && time.Now().After(c.returnAt) {
+		if err := c.set(Host); err != nil {
+			return err
+		}
+	}
+	owner, err := Owner()
+	if err != nil {
+		return err
+	}
+	c.d.Changed("console.owner", owner)
+	c.d.Changed("console.return.units.seconds",
+		strconv.Itoa(int(c.returnAfter/time.Second)))
+	return nil
+}
+
+// set gives the console to owner, arming the return to the host if the
+// owner is the bmc and console.return.units.seconds isn't zero.
+func (c *Command) set(owner string) error {
+	if daemon.Stopped() {
+		return errStopped
+	}
+	old, _ := c.d.Last("console.owner")
+	if err := SetOwner(owner); err != nil {
+		return err
+	}
+	c.returnAt = time.Time{}
+	if owner == Bmc && c.returnAfter > 0 {
+		c.returnAt = time.Now().Add(c.returnAfter)
+	}
+	if old != owner {
+		eventlog.Record(eventlog.Notice, "consoled", "console.owner",
+			old, owner, "console owner %s", owner)
+	}
+	return nil
+}
+
+// errStopped is returned while i2cd has stopped daemon polling, e.g. while
+// the host power cycles.
+var errStopped = errors.New("i2c stopped")
+
+// rwReg reads or writes a register of the gpio expander through i2cd, like
+// the other daemons' devices.
+func rwReg(rw i2c.RW, reg, v uint8) (uint8, error) {
+	var j [daemon.MAXOPS]daemon.I
+	var s [daemon.MAXOPS]daemon.R
+	j[0] = daemon.I{
+		InUse:     true,
+		RW:        rw,
+		RegOffset: reg,
+		BusSize:   i2c.ByteData,
+		Bus:       i2cBus,
+		Addr:      i2cGpioAddr,
+	}
+	j[0].Data[0] = v
+	if err := daemon.I2cRpc(&j, &s); err != nil {
+		return 0, err
+	}
+	return s[0].D[0], s[0].E
+}
+
+func readReg(reg uint8) (uint8, error) {
+	return rwReg(i2c.Read, reg, 0)
+}
+
+func writeReg(reg, v uint8) error {
+	_, err := rwReg(i2c.Write, reg, v)
+	return err
+}
+
+// Owner returns the owner of the console port from the mux select.
+func Owner() (string, error) {
+	config, err := readReg(regConfig)
+	if err != nil {
+		return "", err
+	}
+	out, err := readReg(regOutput)
+	if err != nil {
+		return "", err
+	}
+	if config&uartSel == 0 && out&uartSel != 0 {
+		return Bmc, nil
+	}
+	return Host, nil
+}
+
+// SetOwner gives the console port to owner; it does nothing if owner
+// already has it. While the bmc has it, the front panel button is disabled
+// so it can't be taken back; once returned to the host, the button is as
+// startConfGpioHook left it.
+func SetOwner(owner string) error {
+	config, err := readReg(regConfig)
+	if err != nil {
+		return err
+	}
+	switch owner {
+	case Bmc:
+		out, err := readReg(regOutput)
+		if err != nil {
+			return err
+		}
+		if err = writeReg(regOutput, out|uartSel); err != nil {
+			return err
+		}
+		err = writeReg(regConfig, config&^uartSel)
+		if err != nil {
+			return err
+		}
+		return SetButton(false)
+	case Host:
+		err = writeReg(regConfig, config|uartSel)
+		if err != nil {
+			return err
+		}
+		return SetButton(Button)
+	}
+	return fmt.Errorf("%s: unknown owner", owner)
+}
+
+// SetButton enables or disables the front panel button.
+func SetButton(enable bool) error {
+	pin, found := gpio.FindPin(GpioButtonEnL)
+	if !found {
+		return nil
+	}
+	return pin.SetValue(!enable)
+}
+
+func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package daemon provides what the BMC device daemons have in common:
+// startup, the Hset RPC server, the polling loop and publishing of changed
+// values to redis.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/atsock"
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/external/redis/publisher"
+	"github.com/platinasystems/log"
+)
+
+type Daemon struct {
+	Name string
+	Pub  *publisher.Publisher
+
+	rpc   *atsock.RpcServer
+	mutex sync.Mutex
+	last  map[string]string
+	errs  map[string]string
+	keys  map[string]*Key
+	write chan *write
+
+	handlers []handler
+}
+
+// write is an hset applied by Run between ticks.
+type write struct {
+	key  *Key
+	v    interface{}
+	done chan error
+}
+
+// Ticker calls Func every Interval.
+type Ticker struct {
+	Name     string
+	Interval time.Duration
+	Func     func() error
+}
+
+func New(name string) *Daemon {
+	return &Daemon{
+		Name:  name,
+		last:  make(map[string]string),
+		errs:  make(map[string]string),
+		keys:  make(map[string]*Key),
+		write: make(chan *write),
+	}
+}
+
+// Start checks the daemon's writable keys, waits for redis, then serves
+// the methods of rcvr, the daemon's Info, for writes to those keys.
+func (d *Daemon) Start(rcvr interface{}) error {
+	keys := Schema(d.Name)
+	if err := CheckSchema(d.Name, keys); err != nil {
+		return err
+	}
+	for i := range keys {
+		d.keys[keys[i].Name] = &keys[i]
+	}
+	err := redis.IsReady()
+	if err != nil {
+		return err
+	}
+	if d.Pub, err = publisher.New(); err != nil {
+		return err
+	}
+	if d.rpc, err = atsock.NewRpcServer(d.Name); err != nil {
+		return err
+	}
+	rpc.Register(rcvr)
+	for _, prefix := range Prefixes(d.Name, keys) {
+		err = redis.Assign(redis.DefaultHash+":"+prefix, d.Name, "Info")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hsetTimeout limits how long Hset waits for Run to apply a write.
+var hsetTimeout = 10 * time.Second
+
+// Hset parses and applies a write of a key in the daemon's schema, then
+// publishes its new value. The key's handler runs between ticks of Run, so
+// a ticker or handler that calls Hset of its own daemon can't be served;
+// after hsetTimeout it, and any write waiting on it, gets a busy error.
+func (d *Daemon) Hset(field, value string) error {
+	k, found := d.keys[field]
+	if !found {
+		return fmt.Errorf("cannot hset: %s", field)
+	}
+	v, s, err := k.Parse(value)
+	if err != nil {
+		return err
+	}
+	w := &write{k, v, make(chan error, 1)}
+	timeout := time.After(hsetTimeout)
+	select {
+	case d.write <- w:
+	case <-timeout:
+		return errors.New(d.Name + " busy")
+	}
+	select {
+	case err = <-w.done:
+	case <-timeout:
+		return errors.New(d.Name + " busy")
+	}
+	if err != nil {
+		return err
+	}
+	d.Publish(field, s)
+	return nil
+}
+
+// Run calls the ticker functions and the handlers of writes and events, one
+// at a time, until stopped. Errors are logged when they change rather than
+// on every tick.
+func (d *Daemon) Run(tickers ...Ticker) error {
+	done := make(chan struct{})
+	defer close(done)
+	due := make(chan *Ticker)
+	for i := range tickers {
+		go func(t *Ticker) {
+			tk := time.NewTicker(t.Interval)
+			defer tk.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-tk.C:
+					select {
+					case due <- t:
+					case <-done:
+						return
+					}
+				}
+			}
+		}(&tickers[i])
+	}
+	events := make(chan event)
+	for i := range d.handlers {
+		h := &d.handlers[i]
+		go h.watch(h, events, done)
+	}
+	for {
+		select {
+		case <-goes.Stop:
+			return nil
+		case t := <-due:
+			d.Check(t.Name, t.Func())
+		case w := <-d.write:
+			w.done <- w.key.Set(w.v)
+		case e := <-events:
+			d.Check(e.h.name, e.h.f(e.msg))
+		}
+	}
+}
+
+// Check logs err, or its recovery, if it differs from the last result of
+// the named operation.
+func (d *Daemon) Check(name string, err error) {
+	s := ""
+	if err != nil {
+		s = err.Error()
+	}
+	d.mutex.Lock()
+	last := d.errs[name]
+	d.errs[name] = s
+	d.mutex.Unlock()
+	if s == last {
+		return
+	}
+	if err != nil {
+		log.Print("warning: ", d.Name, " ", name, ": ", err)
+	} else {
+		log.Print("notice: ", d.Name, " ", name, ": recovered")
+	}
+}
+
+// Publish prints a key's value to redis.
+func (d *Daemon) Publish(key string, v interface{}) {
+	s := fmt.Sprint(v)
+	d.mutex.Lock()
+	d.last[key] = s
+	d.mutex.Unlock()
+	d.Pub.Print(key, ": ", s)
+}
+
+// Changed publishes a key's value if it differs from the last published,
+// and reports whether it did.
+func (d *Daemon) Changed(key string, v interface{}) bool {
+	s := fmt.Sprint(v)
+	d.mutex.Lock()
+	last, found := d.last[key]
+	d.last[key] = s
+	d.mutex.Unlock()
+	if found && last == s {
+		return false
+	}
+	d.Pub.Print(key, ": ", s)
+	return true
+}
+
+// Last returns the value last published for key.
+func (d *Daemon) Last(key string) (string, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	s, found := d.last[key]
+	return s, found
+}
+
+// Forget causes the next value of key to be published, changed or not.
+func (d *Daemon) Forget(key string) {
+	d.mutex.Lock()
+	delete(d.last, key)
+	d.mutex.Unlock()
+}
+
+// Delete removes a key from redis.
+func (d *Daemon) Delete(key string) {
+	d.Forget(key)
+	d.Pub.Print("delete: ", key)
+}
@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes/external/redis/publisher"
+)
+
+func TestPoll(t *testing.T) {
+	d := New("test")
+	d.Pub, _ = publisher.New()
+	n := 0
+	sensors := []Sensor{
+		{"a", Int(func() (int, error) { n++; return n / 2, nil })},
+		{"b", Uint8(func() (uint8, error) { return 0, errors.New("nak") })},
+		{"c", Value(func() string { return "ok" })},
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.Poll(sensors); err == nil || err.Error() != "nak" {
+			t.Fatal("expected nak, got", err)
+		}
+	}
+	if v, _ := d.Last("a"); v != "1" {
+		t.Error("a:", v)
+	}
+	if _, found := d.Last("b"); found {
+		t.Error("b published despite error")
+	}
+	if d.Changed("c", "ok") {
+		t.Error("c changed")
+	}
+	d.Forget("c")
+	if !d.Changed("c", "ok") {
+		t.Error("c not republished after Forget")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	set := func(interface{}) error { return nil }
+	k := Key{Name: "t.int", Type: IntKey, Min: 1, Max: 10, Set: set}
+	for s, ok := range map[string]bool{"1": true, "10": true, "0": false,
+		"11": false, "x": false} {
+		if _, _, err := k.Parse(s); (err == nil) != ok {
+			t.Errorf("%s %q: %v", k.Name, s, err)
+		}
+	}
+	k = Key{Name: "t.dur", Type: DurationKey, Max: 60, Set: set}
+	if v, s, err := k.Parse("30"); err != nil || s != "30s" ||
+		v.(time.Duration) != 30*time.Second {
+		t.Error(k.Name, v, s, err)
+	}
+	if _, _, err := k.Parse("2m"); err == nil {
+		t.Error(k.Name, "2m accepted")
+	}
+	k = Key{Name: "t.enum", Type: EnumKey, Values: []string{"a", "b"},
+		Set: set}
+	if _, _, err := k.Parse("c"); err == nil {
+		t.Error(k.Name, "c accepted")
+	}
+	for _, bad := range [][]Key{
+		{{Name: "nodot", Set: set}},
+		{{Name: "t.x"}},
+		{{Name: "t.x", Type: EnumKey, Set: set}},
+		{{Name: "t.x", Type: BoolKey, Values: []string{"y"}, Set: set}},
+		{{Name: "t.x", Type: IntKey, Min: 2, Max: 1, Set: set}},
+		{{Name: "t.x", Type: TextKey, Max: 1, Set: set}},
+		{{Name: "t.x", Set: set}, {Name: "t.x", Set: set}},
+	} {
+		if err := CheckSchema("test", bad); err == nil {
+			t.Error("accepted", bad[0].Name)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	set := func(interface{}) error { return nil }
+	Writable("test-a", Key{Name: "tp.a", Set: set},
+		Key{Name: "tp.b", Set: set}, Key{Name: "tq.a", Set: set})
+	Writable("test-b", Key{Name: "tq.b", Set: set})
+	got := Prefixes("test-a", Schema("test-a"))
+	want := []string{"tp.", "tq.a"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHsetReentry(t *testing.T) {
+	defer func(d time.Duration) { hsetTimeout = d }(hsetTimeout)
+	hsetTimeout = 100 * time.Millisecond
+	d := New("test")
+	d.Pub, _ = publisher.New()
+	inner := make(chan error, 1)
+	d.keys["t.inner"] = &Key{Name: "t.inner", Type: TextKey,
+		Set: func(interface{}) error { return nil }}
+	d.keys["t.outer"] = &Key{Name: "t.outer", Type: TextKey,
+		Set: func(interface{}) error {
+			inner <- d.Hset("t.inner", "x")
+			return nil
+		}}
+	go d.Run()
+	d.Hset("t.outer", "x")
+	if err := <-inner; err == nil {
+		t.Error("re-entrant Hset succeeded")
+	}
+	// Run is free again
+	if err := d.Hset("t.inner", "y"); err != nil {
+		t.Error(err)
+	}
+}
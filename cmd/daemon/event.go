@@ -0,0 +1,103 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package daemon
+
+import (
+	"time"
+
+	redigo "github.com/garyburd/redigo/redis"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/external/redis/publisher"
+)
+
+// PowerEvent is the channel on which ucd9090d announces, as
+// "fault: RAIL.FAULT", that the rails were power cycled, so that each
+// daemon re-initializes its own devices.
+const PowerEvent = "power.event"
+
+// handler is a function that Run calls with each message of a source,
+// such as a redis channel or a gpio, that its watch function delivers.
+type handler struct {
+	name  string
+	f     func(msg string) error
+	watch func(h *handler, events chan<- event, done <-chan struct{})
+}
+
+// event is a message received for a handler.
+type event struct {
+	h   *handler
+	msg string
+}
+
+// Notify sends "field: value" to the daemons that handle channel. redisd
+// has no PUBLISH command; instead it sends what's printed to its publisher
+// socket as "channel: field: value" to the subscribers of channel, and
+// keeps it in the channel's hash. Neither field nor value may contain ": ".
+func Notify(channel, field, value string) error {
+	pub, err := publisher.New()
+	if err != nil {
+		return err
+	}
+	defer pub.Close()
+	_, err = pub.Print(channel, ": ", field, ": ", value)
+	return err
+}
+
+// On calls f with each "field: value" notified on channel. Like writes, f
+// runs between ticks of Run, so it may use the daemon's devices without
+// locking. On must be called before Run.
+func (d *Daemon) On(channel string, f func(msg string) error) {
+	d.handlers = append(d.handlers, handler{channel, f, d.subscribe})
+}
+
+// subscribe delivers the messages of h.name to events until done,
+// reconnecting as needed.
+func (d *Daemon) subscribe(h *handler, events chan<- event,
+	done <-chan struct{}) {
+	for {
+		psc, err := redis.Subscribe(h.name)
+		if err == nil {
+			d.Check("subscribe "+h.name, nil)
+			closed := make(chan struct{})
+			go func() {
+				select {
+				case <-done:
+					psc.Close()
+				case <-closed:
+				}
+			}()
+			err = d.receive(psc, h, events, done)
+			close(closed)
+			psc.Close()
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+		d.Check("subscribe "+h.name, err)
+		select {
+		case <-done:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (d *Daemon) receive(psc redigo.PubSubConn, h *handler,
+	events chan<- event, done <-chan struct{}) error {
+	for {
+		switch t := psc.Receive().(type) {
+		case redigo.Message:
+			select {
+			case events <- event{h, string(t.Data)}:
+			case <-done:
+				return nil
+			}
+		case error:
+			return t
+		}
+	}
+}
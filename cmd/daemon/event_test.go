@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	redigo "github.com/garyburd/redigo/redis"
+	"github.com/platinasystems/goes/cmd/redisd"
+	"github.com/platinasystems/goes/external/redis"
+)
+
+func TestNotify(t *testing.T) {
+	go (&redisd.Command{}).Main("-port", "0", "lo")
+	var psc redigo.PubSubConn
+	var err error
+	for i := 0; ; i++ {
+		if psc, err = redis.Subscribe(PowerEvent); err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatal("redisd: ", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer psc.Close()
+	msgs := make(chan interface{}, 2)
+	go func() {
+		for {
+			v := psc.Receive()
+			msgs <- v
+			if _, ok := v.(error); ok {
+				return
+			}
+		}
+	}()
+	// the subscription is confirmed before anything is sent to it
+	select {
+	case v := <-msgs:
+		if _, ok := v.(redigo.Subscription); !ok {
+			t.Fatal("subscribe:", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscribe: timeout")
+	}
+	if err = Notify(PowerEvent, "fault", "P1V0.VOUT_UV"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-msgs:
+		m, ok := v.(redigo.Message)
+		if !ok || m.Channel != PowerEvent ||
+			string(m.Data) != "fault: P1V0.VOUT_UV" {
+			t.Fatalf("got %#v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+}
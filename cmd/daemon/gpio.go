@@ -0,0 +1,116 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/platinasystems/gpio"
+)
+
+// Gpio edges on which OnEdge may interrupt.
+const (
+	Rising  = "rising"
+	Falling = "falling"
+	Both    = "both"
+)
+
+// OnEdge calls f with "0" or "1", the new value of the named gpio input,
+// whenever the kernel reports the given edge on it. An error means the pin
+// can't interrupt and the daemon must poll it instead. OnEdge must be
+// called before Run.
+func (d *Daemon) OnEdge(pin, edge string, f func(msg string) error) error {
+	p, found := gpio.FindPin(pin)
+	if !found {
+		return fmt.Errorf("%s: not found", pin)
+	}
+	ef, _, err := p.Open("edge")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(ef, edge)
+	ef.Close()
+	if err != nil {
+		return fmt.Errorf("%s: edge %s: %w", pin, edge, err)
+	}
+	value, _, err := p.Open("value")
+	if err != nil {
+		return err
+	}
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		value.Close()
+		return fmt.Errorf("%s: %w", pin, err)
+	}
+	ev := syscall.EpollEvent{
+		Events: syscall.EPOLLPRI | syscall.EPOLLERR,
+		Fd:     int32(value.Fd()),
+	}
+	err = syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, int(ev.Fd), &ev)
+	if err == nil {
+		// sysfs reports an edge until the value is first read
+		_, err = readValue(value)
+	}
+	if err != nil {
+		syscall.Close(epfd)
+		value.Close()
+		return fmt.Errorf("%s: %w", pin, err)
+	}
+	d.handlers = append(d.handlers, handler{pin, f,
+		func(h *handler, events chan<- event, done <-chan struct{}) {
+			defer value.Close()
+			defer syscall.Close(epfd)
+			d.Check("edge "+h.name, d.watchEdge(h, value, epfd,
+				events, done))
+		},
+	})
+	return nil
+}
+
+// watchEdge delivers the value of the pin to events after each edge until
+// done. It waits at most a second at a time to notice done.
+func (d *Daemon) watchEdge(h *handler, value *os.File, epfd int,
+	events chan<- event, done <-chan struct{}) error {
+	evs := make([]syscall.EpollEvent, 1)
+	for {
+		n, err := syscall.EpollWait(epfd, evs, 1000)
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		v, err := readValue(value)
+		if err != nil {
+			return err
+		}
+		select {
+		case events <- event{h, v}:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// readValue returns the "0" or "1" of a gpio value file and acknowledges
+// its edge.
+func readValue(f *os.File) (string, error) {
+	buf := make([]byte, 2)
+	n, err := f.ReadAt(buf, 0)
+	if n == 0 {
+		return "", err
+	}
+	return string(buf[:1]), nil
+}
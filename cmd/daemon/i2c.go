@@ -0,0 +1,100 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package daemon
+
+import (
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/i2c"
+	"github.com/platinasystems/log"
+)
+
+const MAXOPS = 30
+
+// I is an i2c operation performed by i2cd.
+type I struct {
+	InUse     bool
+	RW        i2c.RW
+	RegOffset uint8
+	BusSize   i2c.SMBusSize
+	Data      [i2c.BlockMax]byte
+	Bus       int
+	Addr      int
+	Delay     int
+}
+
+// R is the result of an operation.
+type R struct {
+	D [i2c.BlockMax]byte
+	E error
+}
+
+var client struct {
+	sync.Mutex
+	*rpc.Client
+}
+
+// I2cRpc has i2cd perform the operations of j, filling s with the results.
+// j and s point to a daemon's own [MAXOPS] arrays of types shaped like I
+// and R.
+func I2cRpc(j, s interface{}) error {
+	client.Lock()
+	defer client.Unlock()
+	if client.Client == nil {
+		c, err := rpc.DialHTTP("tcp", "127.0.0.1"+":1233")
+		if err != nil {
+			log.Print("dialing:", err)
+			return err
+		}
+		client.Client = c
+		time.Sleep(time.Millisecond * time.Duration(50))
+	}
+	err := client.Call("I2cReq.ReadWrite", j, s)
+	if err != nil {
+		log.Print("i2cReq error:", err)
+		if _, ok := err.(rpc.ServerError); !ok {
+			// lost i2cd; dial again next time
+			client.Close()
+			client.Client = nil
+		}
+	}
+	return err
+}
+
+// special performs an i2cd control operation, addressed to a bus beyond
+// those of the hardware.
+func special(size i2c.SMBusSize, bus, addr int) (byte, error) {
+	var j [MAXOPS]I
+	var s [MAXOPS]R
+	j[0] = I{
+		InUse:   true,
+		RW:      i2c.Write,
+		BusSize: size,
+		Bus:     bus,
+		Addr:    addr,
+	}
+	err := I2cRpc(&j, &s)
+	return s[0].D[0], err
+}
+
+// Stopped reports whether i2cd has stopped polling, e.g. while the host
+// power cycles, or can't be reached.
+func Stopped() bool {
+	v, err := special(i2c.ByteData, 0x98, 0)
+	return err != nil || v == 1
+}
+
+// StopI2c and StartI2c suspend and resume daemon i2c polling.
+func StopI2c() error {
+	_, err := special(0, 0x99, 1)
+	return err
+}
+
+func StartI2c() error {
+	_, err := special(0, 0x99, 0)
+	return err
+}
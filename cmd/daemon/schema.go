@@ -0,0 +1,254 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is the type of a writable key's value.
+type Type int
+
+const (
+	TextKey Type = iota
+	IntKey
+	FloatKey
+	EnumKey
+	BoolKey
+	DurationKey
+)
+
+var typeNames = []string{
+	TextKey:     "text",
+	IntKey:      "int",
+	FloatKey:    "float",
+	EnumKey:     "enum",
+	BoolKey:     "bool",
+	DurationKey: "duration",
+}
+
+func (t Type) String() string {
+	if t < 0 || int(t) >= len(typeNames) {
+		return "type(" + strconv.Itoa(int(t)) + ")"
+	}
+	return typeNames[t]
+}
+
+// Key defines a key that may be written with hset and the handler that
+// applies it. Set receives the parsed value: a string for TextKey and
+// EnumKey, int64 for IntKey, float64 for FloatKey, bool for BoolKey and
+// time.Duration for DurationKey. Min and Max bound numeric values, in
+// seconds for DurationKey, unless both are zero.
+type Key struct {
+	Name     string
+	Type     Type
+	Min, Max float64
+	Values   []string
+	Set      func(v interface{}) error
+}
+
+// Valid reports a definition that can't be written.
+func (k *Key) Valid() error {
+	switch {
+	case k.Name == "" || strings.HasPrefix(k.Name, ".") ||
+		!strings.Contains(k.Name, "."):
+		return fmt.Errorf("%q: key must be DEVICE.FIELD", k.Name)
+	case k.Set == nil:
+		return fmt.Errorf("%s: no handler", k.Name)
+	case k.Type < TextKey || k.Type > DurationKey:
+		return fmt.Errorf("%s: %v", k.Name, k.Type)
+	case k.Type == EnumKey && len(k.Values) == 0:
+		return fmt.Errorf("%s: enum without values", k.Name)
+	case k.Type != EnumKey && len(k.Values) > 0:
+		return fmt.Errorf("%s: values of %v key", k.Name, k.Type)
+	case k.Min > k.Max:
+		return fmt.Errorf("%s: min %v > max %v", k.Name, k.Min, k.Max)
+	case k.Min != 0 || k.Max != 0:
+		switch k.Type {
+		case IntKey, FloatKey, DurationKey:
+		default:
+			return fmt.Errorf("%s: range of %v key", k.Name, k.Type)
+		}
+	}
+	return nil
+}
+
+// Parse returns the typed value of s and its canonical form to publish.
+func (k *Key) Parse(s string) (interface{}, string, error) {
+	s = strings.TrimSpace(s)
+	switch k.Type {
+	case IntKey:
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %q isn't an integer",
+				k.Name, s)
+		}
+		if err = k.inRange(float64(i)); err != nil {
+			return nil, "", err
+		}
+		return i, strconv.FormatInt(i, 10), nil
+	case FloatKey:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %q isn't a number",
+				k.Name, s)
+		}
+		if err = k.inRange(f); err != nil {
+			return nil, "", err
+		}
+		return f, strconv.FormatFloat(f, 'f', -1, 64), nil
+	case EnumKey:
+		for _, v := range k.Values {
+			if s == v {
+				return s, s, nil
+			}
+		}
+		return nil, "", fmt.Errorf("%s: valid values are: %s",
+			k.Name, strings.Join(k.Values, ", "))
+	case BoolKey:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %q isn't true or false",
+				k.Name, s)
+		}
+		return b, strconv.FormatBool(b), nil
+	case DurationKey:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			// plain seconds
+			i, ierr := strconv.ParseUint(s, 10, 32)
+			if ierr != nil {
+				return nil, "", fmt.Errorf("%s: %v", k.Name, err)
+			}
+			d = time.Duration(i) * time.Second
+		}
+		if err = k.inRange(d.Seconds()); err != nil {
+			return nil, "", err
+		}
+		return d, d.String(), nil
+	}
+	return s, s, nil
+}
+
+func (k *Key) inRange(f float64) error {
+	if (k.Min != 0 || k.Max != 0) && (f < k.Min || f > k.Max) {
+		return fmt.Errorf("%s: valid range is %v to %v",
+			k.Name, k.Min, k.Max)
+	}
+	return nil
+}
+
+// Range describes the values accepted by the key.
+func (k *Key) Range() string {
+	switch {
+	case k.Type == EnumKey:
+		return strings.Join(k.Values, "|")
+	case k.Type == BoolKey:
+		return "true|false"
+	case k.Min != 0 || k.Max != 0:
+		return fmt.Sprint(k.Min, "..", k.Max)
+	}
+	return ""
+}
+
+// Prefixes returns the unique prefixes of keys to assign to the named
+// daemon: "DEVICE." if no other daemon writes keys of that device,
+// otherwise the key itself.
+func Prefixes(name string, keys []Key) []string {
+	shared := make(map[string]bool)
+	for _, other := range Daemons() {
+		if other == name {
+			continue
+		}
+		for _, k := range Schema(other) {
+			shared[device(k.Name)] = true
+		}
+	}
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		prefix := device(k.Name) + "."
+		if shared[device(k.Name)] {
+			prefix = k.Name
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func device(key string) string {
+	return key[:strings.Index(key, ".")]
+}
+
+var schema struct {
+	sync.Mutex
+	byDaemon map[string][]Key
+}
+
+// Writable declares the keys written through the named daemon. Packages
+// call this from init so that the schema is known to all commands.
+func Writable(name string, keys ...Key) {
+	schema.Lock()
+	defer schema.Unlock()
+	if schema.byDaemon == nil {
+		schema.byDaemon = make(map[string][]Key)
+	}
+	schema.byDaemon[name] = append(schema.byDaemon[name], keys...)
+}
+
+// Schema returns the keys declared for the named daemon.
+func Schema(name string) []Key {
+	schema.Lock()
+	defer schema.Unlock()
+	return append([]Key(nil), schema.byDaemon[name]...)
+}
+
+// Daemons returns the names of the daemons that have writable keys.
+func Daemons() []string {
+	schema.Lock()
+	defer schema.Unlock()
+	var names []string
+	for name := range schema.byDaemon {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckSchema rejects invalid and duplicate definitions in keys and keys
+// that are also declared by another daemon.
+func CheckSchema(name string, keys []Key) error {
+	seen := make(map[string]bool)
+	for i := range keys {
+		k := &keys[i]
+		if err := k.Valid(); err != nil {
+			return err
+		}
+		if seen[k.Name] {
+			return fmt.Errorf("%s: defined twice", k.Name)
+		}
+		seen[k.Name] = true
+	}
+	for _, other := range Daemons() {
+		if other == name {
+			continue
+		}
+		for _, k := range Schema(other) {
+			if seen[k.Name] {
+				return fmt.Errorf("%s: also written by %s",
+					k.Name, other)
+			}
+		}
+	}
+	return nil
+}
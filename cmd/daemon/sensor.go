@@ -0,0 +1,58 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package daemon
+
+// Reader returns a sensor value to publish.
+type Reader func() (interface{}, error)
+
+// Sensor is a published key and the reader of its value.
+type Sensor struct {
+	Key  string
+	Read Reader
+}
+
+// Poll reads each sensor and publishes the values that changed. A failed
+// read does not stop the others; the first error is returned.
+func (d *Daemon) Poll(sensors []Sensor) error {
+	var first error
+	for _, s := range sensors {
+		v, err := s.Read()
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		d.Changed(s.Key, v)
+	}
+	return first
+}
+
+// The following adapt typed device methods to Readers.
+
+func Uint16(f func() (uint16, error)) Reader {
+	return func() (interface{}, error) { return f() }
+}
+
+func Uint8(f func() (uint8, error)) Reader {
+	return func() (interface{}, error) { return f() }
+}
+
+func Int(f func() (int, error)) Reader {
+	return func() (interface{}, error) { return f() }
+}
+
+func Float(f func() (float64, error)) Reader {
+	return func() (interface{}, error) { return f() }
+}
+
+func String(f func() (string, error)) Reader {
+	return func() (interface{}, error) { return f() }
+}
+
+// Value adapts a method that can't fail.
+func Value(f func() string) Reader {
+	return func() (interface{}, error) { return f(), nil }
+}
@@ -0,0 +1,146 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package diag
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/eeprom"
+	"github.com/platinasystems/goes-bmc/cmd/board"
+	"github.com/platinasystems/goes-bmc/cmd/ucd9090d"
+	"github.com/platinasystems/i2c"
+	"github.com/platinasystems/log"
+)
+
+// diagBoard reads the eeprom and selects the board description for it. If
+// the eeprom can't be read, it warns and carries on as a tor1, the board
+// description's default.
+func diagBoard() (*eeprom.Device, *board.Board, error) {
+	d := &eeprom.Device{
+		BusIndex:   0,
+		BusAddress: 0x55,
+	}
+	id := board.ID{Chassis: board.Unknown, Board: board.Unknown,
+		Version: board.Unknown}
+	if err := d.GetInfo(); err != nil {
+		fmt.Println("warning: eeprom:", err)
+	} else {
+		id = board.ID{
+			Chassis: int(d.Fields.ChassisType),
+			Board:   int(d.Fields.BoardType),
+			Version: int(d.Fields.DeviceVersion),
+		}
+	}
+	b, err := board.Select(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, b, nil
+}
+
+func diagHeader() {
+	fmt.Printf("\n%15s|%25s|%10s|%10s|%10s|%10s|%6s|%35s\n", "function", "parameter", "units", "value", "min", "max", "result", "description")
+	fmt.Printf("---------------|-------------------------|----------|----------|----------|----------|------|-----------------------------------\n")
+}
+
+// diagI2cBoard checks the i2c monitor pins and devices listed by the
+// board description.
+func diagI2cBoard(b *board.Board) {
+	if len(b.Diag.MonPins) == 0 && len(b.Diag.I2c) == 0 {
+		fmt.Println("no i2c diag described for", b.Name)
+		return
+	}
+
+	// avoid conflicts w/ interrupt handlers.
+	// i2c STOP
+	sd[0] = 0
+	j[0] = I{true, i2c.Write, 0, 0, sd, int(0x99), int(1), 0}
+	if err := DoI2cRpc(); err != nil {
+		log.Print(err)
+	}
+
+	diagHeader()
+
+	for _, name := range b.Diag.MonPins {
+		pinstate, _ := gpioGet(name)
+		r := CheckPassB(pinstate, true)
+		fmt.Printf("%15s|%25s|%10s|%10t|%10t|%10t|%6s|%35s\n", "i2c", strings.ToLower(name), "-", pinstate, i2cmon_min, i2cmon_max, r, "check mon pin is high")
+	}
+
+	for _, p := range b.Diag.I2c {
+		if p.Mux != 0 {
+			diagI2cWrite1Byte(uint8(p.Bus), uint8(p.Mux),
+				uint8(1<<uint(p.Channel)))
+			time.Sleep(10 * time.Millisecond)
+		}
+		var result bool
+		if p.Word {
+			result, _ = diagI2cPingWord(uint8(p.Bus), uint8(p.Addr), 0x00, 10)
+		} else {
+			result, _ = diagI2cPing(uint8(p.Bus), uint8(p.Addr), 0x00, 10)
+		}
+		r := CheckPassB(result, true)
+		fmt.Printf("%15s|%25s|%10s|%10t|%10t|%10t|%6s|%35s\n", "i2c", "ping_"+p.Name, "-", result, i2cping_response_min, i2cping_response_max, r, "ping device 10x")
+		if p.Mux != 0 {
+			diagI2cWrite1Byte(uint8(p.Bus), uint8(p.Mux), 0x00)
+		}
+	}
+
+	//i2c START
+	sd[0] = 0
+	j[0] = I{true, i2c.Write, 0, 0, sd, int(0x99), int(0), 0}
+	if err := DoI2cRpc(); err != nil {
+		log.Print(err)
+	}
+}
+
+// diagPowerBoard checks the ucd9090 rails listed by the board description.
+// A board without them isn't supported, which is an error rather than a
+// pass.
+func diagPowerBoard(b *board.Board) error {
+	if len(b.Diag.Rails) == 0 {
+		return fmt.Errorf("%s: no power rails described, not supported",
+			b.Name)
+	}
+	pm := diagUcd(b)
+
+	diagHeader()
+
+	for _, rail := range b.Diag.Rails {
+		if rail.Page < 1 || rail.Page > 10 {
+			return fmt.Errorf("%s: page %d out of range",
+				rail.Name, rail.Page)
+		}
+		f, err := pm.Vout(rail.Page)
+		if err != nil {
+			return err
+		}
+		r := CheckPassF(f, rail.Min, rail.Max)
+		fmt.Printf("%15s|%25s|%10s|%10.3f|%10.3f|%10.3f|%6s|%35s\n", "power", rail.Name, "V", f, rail.Min, rail.Max, r, "check rail is within limits")
+	}
+	return nil
+}
+
+// diagUcd returns the board's ucd9090, behind its mux, if any.
+func diagUcd(b *board.Board) ucd9090d.I2cDev {
+	return ucd9090d.I2cDev{
+		Bus:      b.Ucd9090d.Bus,
+		Addr:     b.Ucd9090d.Addr,
+		MuxBus:   b.Ucd9090d.Bus,
+		MuxAddr:  b.Ucd9090d.Mux,
+		MuxValue: b.Ucd9090d.MuxValue(),
+	}
+}
+
+// isCh1 reports whether the eeprom chassis type is any size of CH1.
+func isCh1(chassis uint8) bool {
+	switch chassis {
+	case chassisType4Ch1, chassisType8Ch1, chassisType16Ch1:
+		return true
+	}
+	return false
+}
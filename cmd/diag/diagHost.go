@@ -14,7 +14,6 @@ import (
 func diagHost() error {
         const (
                 TOR1 uint8      = 0x00
-                CH1 uint8       = 0x01
                 CH1MC uint8     = 0x04
                 CH1LC uint8     = 0x05
         )
@@ -118,9 +117,9 @@ func diagHost() error {
                 if err := diagHostTor(); err != nil {
                         return err
                 }
-        } else if (dev.Fields.ChassisType == CH1) && (dev.Fields.BoardType == CH1MC) {
+        } else if isCh1(dev.Fields.ChassisType) && (dev.Fields.BoardType == CH1MC) {
                 return nil
-        } else if (dev.Fields.ChassisType == CH1) && (dev.Fields.BoardType == CH1MC) {
+        } else if isCh1(dev.Fields.ChassisType) && (dev.Fields.BoardType == CH1LC) {
                 diagHostCh1Lc()
         }
 
@@ -166,7 +165,7 @@ func diagHostTor() error {
 }
 
 
+// diagHostCh1Lc has nothing to add to the tests common to all boards.
 func diagHostCh1Lc() error {
-
 	return nil
 }
@@ -9,7 +9,7 @@ import (
 	"net/rpc"
 	"time"
 
-	"github.com/platinasystems/eeprom"
+	"github.com/platinasystems/goes-bmc/cmd/board"
 	"github.com/platinasystems/i2c"
 	"github.com/platinasystems/log"
 )
@@ -55,33 +55,19 @@ var ucd9090dAdr uint8
 var ledgpiodAdr uint8
 
 func diagI2c() error {
-	ucd9090dAdr = 0x34
-	ledgpiodAdr = 0x75
-
-        d := eeprom.Device{
-                BusIndex:   0,
-                BusAddress: 0x55,
-        }
-        if err := d.GetInfo(); err != nil {
+	d, b, err := diagBoard()
+	if err != nil {
 		return err
 	}
+	ucd9090dAdr = uint8(b.Ucd9090d.Addr)
+	ledgpiodAdr = uint8(b.Ledgpiod.Addr)
+
 	if d.Fields.ChassisType == TOR1 {
-		switch d.Fields.DeviceVersion {
-		case 0xff:
-			ucd9090dAdr = 0x7e
-			ledgpiodAdr = 0x22
-		case 0x00:
-			ucd9090dAdr = 0x7e
-			ledgpiodAdr = 0x22
-		default:
-			ucd9090dAdr = 0x34
-			ledgpiodAdr = 0x75
-		}
 		diagI2cTor()
-	} else if (d.Fields.ChassisType == CH1) && (d.Fields.BoardType == CH1MC) {
+	} else if isCh1(d.Fields.ChassisType) && (d.Fields.BoardType == CH1MC) {
 		diagI2cCh1Mc()
-	} else if (d.Fields.ChassisType == CH1) && (d.Fields.BoardType == CH1MC) {
-                diagI2cCh1Lc()
+	} else if isCh1(d.Fields.ChassisType) && (d.Fields.BoardType == CH1LC) {
+		diagI2cCh1Lc(b)
 	}
 
 	return nil
@@ -649,8 +635,8 @@ func diagI2cCh1Mc() {
         }
 }
 
-func diagI2cCh1Lc() {
-
+func diagI2cCh1Lc(b *board.Board) {
+	diagI2cBoard(b)
 }
 
 func diagSwitchConsole() error {
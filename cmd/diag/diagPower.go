@@ -8,7 +8,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/platinasystems/eeprom"
+	"github.com/platinasystems/goes-bmc/cmd/board"
 	"github.com/platinasystems/goes-bmc/cmd/ucd9090d"
 )
 
@@ -17,41 +17,29 @@ var pm ucd9090d.I2cDev
 func diagPower() error {
 
 	const (
-		ucd9090dBus = 4
-		ucd9090dAdr = 0x34
-
 		TOR1  uint8 = 0x00
-		CH1   uint8 = 0x01
 		CH1MC uint8 = 0x04
 		CH1LC uint8 = 0x05
 	)
 
-	pm = ucd9090d.I2cDev{Bus: ucd9090dBus, Addr: ucd9090dAdr}
-
-	d := eeprom.Device{
-		BusIndex:   0,
-		BusAddress: 0x55,
-	}
-	if err := d.GetInfo(); err != nil {
+	d, b, err := diagBoard()
+	if err != nil {
 		return err
 	}
+	pm = diagUcd(b)
+
 	if d.Fields.ChassisType == TOR1 {
-		switch d.Fields.DeviceVersion {
-		case 0xff:
-			pm.Addr = 0x7e
-		case 0x00:
-			pm.Addr = 0x7e
-		default:
-			pm.Addr = 0x34
-		}
 		if err := diagPowerTor(); err != nil {
 			return err
 		}
-	} else if (d.Fields.ChassisType == CH1) && (d.Fields.BoardType == CH1MC) {
-		pm.Addr = 0x7e
-		diagPowerCh1Mc()
-	} else if (d.Fields.ChassisType == CH1) && (d.Fields.BoardType == CH1MC) {
-		diagPowerCh1Lc()
+	} else if isCh1(d.Fields.ChassisType) && (d.Fields.BoardType == CH1MC) {
+		if err := diagPowerCh1Mc(); err != nil {
+			return err
+		}
+	} else if isCh1(d.Fields.ChassisType) && (d.Fields.BoardType == CH1LC) {
+		if err := diagPowerCh1Lc(b); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -166,30 +154,18 @@ func diagPowerCh1Mc() error {
 	return diagPowerTor()
 }
 
-func diagPowerCh1Lc() {
-
+func diagPowerCh1Lc(b *board.Board) error {
+	return diagPowerBoard(b)
 }
 
 func diagLoggedFaults() error {
-	const (
-		ucd9090dBus = 4
-		ucd9090dAdr = 0x34
-	)
-	var pm = ucd9090d.I2cDev{Bus: ucd9090dBus, Addr: ucd9090dAdr}
-
-	d := eeprom.Device{
-		BusIndex:   0,
-		BusAddress: 0x55,
-	}
-	d.GetInfo()
-	switch d.Fields.DeviceVersion {
-	case 0xff:
-		pm.Addr = 0x7e
-	case 0x00:
-		pm.Addr = 0x7e
-	default:
-		pm.Addr = 0x34
+	_, b, err := diagBoard()
+	if err != nil {
+		return err
 	}
+	var pm = diagUcd(b)
+	ucd9090d.Rails = b.Ucd9090d.Rails
+
 	log, err := pm.LoggedFaultDetail()
 	if err == nil {
 		fmt.Printf("%v", log)
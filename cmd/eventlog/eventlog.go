@@ -0,0 +1,192 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package eventlog provides a persistent log of BMC events, the equivalent
+// of an IPMI system event log.
+package eventlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/goes/external/redis/publisher"
+	"github.com/platinasystems/log"
+)
+
+var (
+	LOGA          = "/perm/events.log"
+	LOGB          = "/perm/events.log.1"
+	MAXSIZE int64 = 256 * 1024
+)
+
+type Severity string
+
+const (
+	Critical Severity = "crit"
+	Error    Severity = "err"
+	Warning  Severity = "warning"
+	Notice   Severity = "notice"
+	Info     Severity = "info"
+)
+
+var rank = map[Severity]int{
+	Critical: 2,
+	Error:    3,
+	Warning:  4,
+	Notice:   5,
+	Info:     6,
+}
+
+// AtLeast reports whether s is as or more severe than min.
+func (s Severity) AtLeast(min Severity) bool {
+	r, found := rank[s]
+	return found && r <= rank[min]
+}
+
+type Event struct {
+	Time     time.Time
+	Severity Severity
+	Source   string
+	Key      string
+	Old      string `json:",omitempty"`
+	New      string `json:",omitempty"`
+	Msg      string `json:",omitempty"`
+}
+
+func (e *Event) String() string {
+	s := fmt.Sprint(e.Time.Format(time.RFC3339), " ", e.Severity, " ",
+		e.Source, " ", e.Key)
+	if e.Old != "" || e.New != "" {
+		s += fmt.Sprint(" ", e.Old, " -> ", e.New)
+	}
+	if e.Msg != "" {
+		s += ": " + e.Msg
+	}
+	return s
+}
+
+var (
+	mutex sync.Mutex
+	pub   *publisher.Publisher
+)
+
+// Record stores an event, publishes it as "event.last", and logs its
+// message with the severity prefix as before.
+func Record(sev Severity, source, key, old, new, format string,
+	args ...interface{}) error {
+	e := &Event{
+		Time:     time.Now(),
+		Severity: sev,
+		Source:   source,
+		Key:      key,
+		Old:      old,
+		New:      new,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+	if e.Msg != "" {
+		log.Print(string(sev), ": ", e.Msg)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pub == nil {
+		pub, _ = publisher.New()
+	}
+	if pub != nil {
+		pub.Print("event.last: ", e)
+	}
+	return write(e)
+}
+
+// lock takes the log's file lock. Every daemon records events, so mutex
+// alone doesn't keep them from rotating the log under each other's append.
+// The lock is on a file of its own since LOGA is renamed. Close the
+// returned file to unlock.
+func lock() (*os.File, error) {
+	f, err := os.OpenFile(LOGA+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func write(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l, err := lock()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	mode := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	f, err := os.OpenFile(LOGA, mode, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	f.Close()
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(LOGA)
+	if err != nil {
+		return err
+	}
+	if fi.Size() > MAXSIZE {
+		return os.Rename(LOGA, LOGB)
+	}
+	return nil
+}
+
+// Read returns the stored events, oldest first.
+func Read() ([]Event, error) {
+	var events []Event
+	for _, fn := range []string{LOGB, LOGA} {
+		f, err := os.Open(fn)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return events, err
+		}
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			var e Event
+			line := strings.TrimSpace(scan.Text())
+			if json.Unmarshal([]byte(line), &e) == nil {
+				events = append(events, e)
+			}
+		}
+		f.Close()
+	}
+	return events, nil
+}
+
+// Clear removes all stored events.
+func Clear() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	l, err := lock()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	for _, fn := range []string{LOGA, LOGB} {
+		if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package eventlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(a, b string, max int64) { LOGA, LOGB, MAXSIZE = a, b, max }(
+		LOGA, LOGB, MAXSIZE)
+	LOGA = filepath.Join(dir, "events.log")
+	LOGB = filepath.Join(dir, "events.log.1")
+	MAXSIZE = 512
+
+	for i := 0; i < 20; i++ {
+		e := &Event{
+			Time:     time.Unix(int64(i), 0),
+			Severity: Warning,
+			Source:   "ledgpiod",
+			Key:      "fan_tray.1.status",
+			Old:      "ok",
+			New:      "warning check fan tray",
+		}
+		if err = write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || len(events) >= 20 {
+		t.Fatal("expected a bounded log, got", len(events), "events")
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Fatal("events out of order")
+		}
+	}
+	if last := events[len(events)-1]; last.Time.Unix() != 19 {
+		t.Fatal("lost the latest event", last.String())
+	}
+	if err = Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ = Read(); len(events) != 0 {
+		t.Fatal("not cleared")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	if !Critical.AtLeast(Warning) || Info.AtLeast(Notice) {
+		t.Fatal("wrong severity order")
+	}
+	if Severity("bogus").AtLeast(Info) {
+		t.Fatal("unknown severity passed")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package eventlog
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/platinasystems/flags"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/parms"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "events" }
+
+func (Command) Usage() string {
+	return "show events [-n COUNT] [-severity LEVEL] [-source DAEMON] [-clear]"
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "print the bmc event log",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Print the persistent event log, oldest first.
+
+	The -n parameter limits output to the last COUNT events.
+	The -severity parameter hides events less severe than LEVEL,
+	one of crit, err, warning, notice or info.
+	The -source parameter selects events from one daemon.
+	The -clear flag erases the log.`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-clear")
+	parm, args := parms.New(args, "-n", "-severity", "-source")
+	if len(args) > 0 {
+		return fmt.Errorf("%v: unexpected", args)
+	}
+	if flag.ByName["-clear"] {
+		return Clear()
+	}
+	min := Info
+	if s := parm.ByName["-severity"]; s != "" {
+		min = Severity(s)
+		if _, found := rank[min]; !found {
+			return fmt.Errorf("%s: unknown severity", s)
+		}
+	}
+	events, err := Read()
+	if err != nil {
+		return err
+	}
+	var sel []Event
+	for _, e := range events {
+		if !e.Severity.AtLeast(min) {
+			continue
+		}
+		if s := parm.ByName["-source"]; s != "" && s != e.Source {
+			continue
+		}
+		sel = append(sel, e)
+	}
+	if s := parm.ByName["-n"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s: invalid count", s)
+		}
+		if n < len(sel) {
+			sel = sel[len(sel)-n:]
+		}
+	}
+	for i := range sel {
+		fmt.Println(sel[i].String())
+	}
+	return nil
+}
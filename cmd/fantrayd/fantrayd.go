@@ -5,19 +5,16 @@
 package fantrayd
 
 import (
-	"fmt"
-	"net/rpc"
 	"strconv"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
 	"github.com/platinasystems/goes/cmd"
-	"github.com/platinasystems/goes/external/atsock"
 	"github.com/platinasystems/goes/external/log"
 	"github.com/platinasystems/goes/external/redis"
-	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/external/redis/rpc/args"
 	"github.com/platinasystems/goes/external/redis/rpc/reply"
 	"github.com/platinasystems/goes/lang"
@@ -28,11 +25,6 @@ var (
 
 	VpageByKey map[string]uint8
 
-	WrRegDv  = make(map[string]string)
-	WrRegFn  = make(map[string]string)
-	WrRegVal = make(map[string]string)
-	WrRegRng = make(map[string][]string)
-
 	fanTrayA = []string{"not installed", "not installed", "not installed", "not installed"}
 )
 
@@ -46,12 +38,7 @@ type Command struct {
 
 type Info struct {
 	mutex sync.Mutex
-	rpc   *atsock.RpcServer
-	pub   *publisher.Publisher
-	stop  chan struct{}
-	last  map[string]float64
-	lasts map[string]string
-	lastu map[string]uint16
+	d     *daemon.Daemon
 }
 
 type I2cDev struct {
@@ -60,6 +47,7 @@ type I2cDev struct {
 	MuxBus   int
 	MuxAddr  int
 	MuxValue int
+	GpioIntL string
 }
 
 func (*Command) String() string { return "fantrayd" }
@@ -75,60 +63,65 @@ func (*Command) Apropos() lang.Alt {
 func (*Command) Kind() cmd.Kind { return cmd.Daemon }
 
 func (c *Command) Main(...string) error {
-	var si syscall.Sysinfo_t
-
 	if c.Init != nil {
 		c.init.Do(c.Init)
 	}
 
-	err := redis.IsReady()
-	if err != nil {
-		return err
-	}
-
 	first = 1
-	c.last = make(map[string]float64)
-	c.lasts = make(map[string]string)
-	c.lastu = make(map[string]uint16)
-
-	if c.pub, err = publisher.New(); err != nil {
+	c.d = daemon.New("fantrayd")
+	if err := c.d.Start(&c.Info); err != nil {
 		return err
 	}
 
-	if err = syscall.Sysinfo(&si); err != nil {
-		return err
-	}
-
-	if c.rpc, err = atsock.NewRpcServer("fantrayd"); err != nil {
-		return err
-	}
+	c.d.On(daemon.PowerEvent, func(string) error {
+		if Vdev.Addr == 0 {
+			return nil
+		}
+		log.Print("notice: re-init fan trays")
+		return Vdev.FanTrayLedReinit()
+	})
 
-	rpc.Register(&c.Info)
-	for _, v := range WrRegDv {
-		err = redis.Assign(redis.DefaultHash+":"+v+".", "fantrayd",
-			"Info")
+	holdoff := 3
+	poll := func() error {
+		if Vdev.Addr == 0 {
+			return nil
+		}
+		if holdoff > 0 {
+			holdoff--
+		}
+		if holdoff > 0 {
+			return nil
+		}
+		err := c.update()
 		if err != nil {
-			return err
+			holdoff = 5
 		}
+		return err
 	}
 
-	holdoff := 3
-	t := time.NewTicker(5 * time.Second)
-	for {
-		select {
-		case <-goes.Stop:
-			return nil
-		case <-t.C:
-			if holdoff > 0 {
-				holdoff--
-			}
-			if holdoff == 0 {
-				if err = c.update(); err != nil {
-					holdoff = 5
+	// The expander interrupts on tray insertion and removal; without
+	// that, poll often enough to notice them.
+	interval := 5 * time.Second
+	if Vdev.Addr != 0 && Vdev.GpioIntL != "" {
+		err := c.d.OnEdge(Vdev.GpioIntL, daemon.Falling,
+			func(string) error {
+				if holdoff > 0 {
+					return nil
 				}
-			}
+				return poll()
+			})
+		if err != nil {
+			log.Print("notice: fantrayd: polling, ", err)
+		} else {
+			interval = 15 * time.Second
 		}
 	}
+
+	return c.d.Run(daemon.Ticker{
+		Name:     "update",
+		Interval: interval,
+		Func:     poll,
+	})
 }
 
 func (c *Command) update() error {
@@ -136,49 +129,107 @@ func (c *Command) update() error {
 	if stopped == 1 {
 		return nil
 	}
-	if err := writeRegs(); err != nil {
-		return err
-	}
 	for k, i := range VpageByKey {
 		v, err := Vdev.FanTrayStatus(i)
 		if err != nil {
 			return err
 		}
-		if v != c.lasts[k] {
-			c.pub.Print(k, ": ", v)
-			c.lasts[k] = v
+		c.d.Changed(k, v)
+	}
+	return c.updateLeds()
+}
+
+// updateLeds publishes what each fan tray LED shows, as read back after
+// FanTrayStatus wrote it, and raises fan_tray.led.alarm if any isn't what
+// was written.
+func (c *Command) updateLeds() error {
+	var bad []string
+	for i := 0; i < nFanTrays; i++ {
+		if fanTrayLedWritten[i] == "" {
+			continue
 		}
+		k := "fan_tray." + strconv.Itoa(i+1) + ".led"
+		c.d.Changed(k, fanTrayLedShows[i])
+		if fanTrayLedShows[i] != fanTrayLedWritten[i] {
+			bad = append(bad, k+" "+fanTrayLedShows[i]+" not "+
+				fanTrayLedWritten[i])
+		}
+	}
+	if len(bad) > 0 && !fanTrayLedAlarm {
+		eventlog.Record(eventlog.Warning, "fantrayd",
+			"fan_tray.led.alarm", "false", "true",
+			"fan tray LED mismatch: %s", strings.Join(bad, ", "))
+	} else if len(bad) == 0 && fanTrayLedAlarm {
+		eventlog.Record(eventlog.Notice, "fantrayd",
+			"fan_tray.led.alarm", "true", "false",
+			"fan tray LEDs match")
 	}
+	fanTrayLedAlarm = len(bad) > 0
+	c.d.Changed("fan_tray.led.alarm", strconv.FormatBool(fanTrayLedAlarm))
 	return nil
 }
 
+// ledColor returns the color of fan tray i's LED from the expander's
+// output bits.
+func ledColor(o, i uint8) string {
+	switch o & fanTrayLedBits[i] {
+	case fanTrayLedGreen[i]:
+		return "green"
+	case fanTrayLedYellow[i]:
+		return "yellow"
+	case fanTrayLedOff[i]:
+		return "off"
+	}
+	return "unknown"
+}
+
 const (
 	fanTrayLeds = 0x33
 	minRpm      = 2000
 )
 
-var fanTrayLedOff = []uint8{0x0, 0x0, 0x0, 0x0}
-var fanTrayLedGreen = []uint8{0x20, 0x02, 0x20, 0x02}
-var fanTrayLedYellow = []uint8{0x10, 0x01, 0x10, 0x01}
-var fanTrayLedBits = []uint8{0x30, 0x03, 0x30, 0x03}
+// LedBits are the expander output bits of an LED: its mask and their value
+// for each color.
+type LedBits struct {
+	Mask, Green, Yellow, Off byte
+}
+
+// Leds are the LEDs of the fan trays of the board.
+var Leds = []LedBits{
+	{Mask: 0x30, Green: 0x20, Yellow: 0x10},
+	{Mask: 0x03, Green: 0x02, Yellow: 0x01},
+	{Mask: 0x30, Green: 0x20, Yellow: 0x10},
+	{Mask: 0x03, Green: 0x02, Yellow: 0x01},
+}
+
+var fanTrayLedOff = make([]uint8, nFanTrays)
+var fanTrayLedGreen = make([]uint8, nFanTrays)
+var fanTrayLedYellow = make([]uint8, nFanTrays)
+var fanTrayLedBits = make([]uint8, nFanTrays)
 var fanTrayDirBits = []uint8{0x80, 0x08, 0x80, 0x08}
 var fanTrayAbsBits = []uint8{0x40, 0x04, 0x40, 0x04}
-var deviceVer int
 var first int
 
+// the colors of the fan tray LEDs last written and read back
+var fanTrayLedWritten, fanTrayLedShows [nFanTrays]string
+var fanTrayLedAlarm bool
+
+// setLeds takes the bits of the fan tray LEDs from Leds.
+func setLeds() {
+	for i := range fanTrayLedBits {
+		var l LedBits
+		if i < len(Leds) {
+			l = Leds[i]
+		}
+		fanTrayLedBits[i], fanTrayLedGreen[i] = l.Mask, l.Green
+		fanTrayLedYellow[i], fanTrayLedOff[i] = l.Yellow, l.Off
+	}
+}
+
 func (h *I2cDev) FanTrayLedInit() error {
 	r := getRegs()
 
-	deviceVer = 0x1
-	s, _ := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
-	_, _ = fmt.Sscan(s, &deviceVer)
-	if deviceVer == 0xff || deviceVer == 0x00 {
-		fanTrayLedGreen = []uint8{0x10, 0x01, 0x10, 0x01}
-		fanTrayLedYellow = []uint8{0x20, 0x02, 0x20, 0x02}
-	} else {
-		fanTrayLedGreen = []uint8{0x20, 0x02, 0x20, 0x02}
-		fanTrayLedYellow = []uint8{0x10, 0x01, 0x10, 0x01}
-	}
+	setLeds()
 
 	r.Output[0].set(h, 0xff&(fanTrayLedOff[2]|fanTrayLedOff[3]))
 	r.Output[1].set(h, 0xff&(fanTrayLedOff[0]|fanTrayLedOff[1]))
@@ -195,16 +246,7 @@ func (h *I2cDev) FanTrayLedInit() error {
 func (h *I2cDev) FanTrayLedReinit() error {
 	r := getRegs()
 
-	deviceVer := 0
-	s, _ := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
-	_, _ = fmt.Sscan(s, &deviceVer)
-	if deviceVer == 0xff || deviceVer == 0x00 {
-		fanTrayLedGreen = []uint8{0x10, 0x01, 0x10, 0x01}
-		fanTrayLedYellow = []uint8{0x20, 0x02, 0x20, 0x02}
-	} else {
-		fanTrayLedGreen = []uint8{0x20, 0x02, 0x20, 0x02}
-		fanTrayLedYellow = []uint8{0x10, 0x01, 0x10, 0x01}
-	}
+	setLeds()
 
 	r.Config[0].set(h, 0xff^fanTrayLeds)
 	r.Config[1].set(h, 0xff^fanTrayLeds)
@@ -230,14 +272,6 @@ func (h *I2cDev) FanTrayStatus(i uint8) (string, error) {
 		first = 0
 	}
 
-	if deviceVer == 0xff || deviceVer == 0x00 {
-		fanTrayLedGreen = []uint8{0x10, 0x01, 0x10, 0x01}
-		fanTrayLedYellow = []uint8{0x20, 0x02, 0x20, 0x02}
-	} else {
-		fanTrayLedGreen = []uint8{0x20, 0x02, 0x20, 0x02}
-		fanTrayLedYellow = []uint8{0x10, 0x01, 0x10, 0x01}
-	}
-
 	r := getRegs()
 	n := 0
 	i--
@@ -311,80 +345,25 @@ func (h *I2cDev) FanTrayStatus(i uint8) (string, error) {
 	if err != nil {
 		return "error", err
 	}
-	return w, nil
-}
 
-func writeRegs() error {
-	for k, v := range WrRegVal {
-		switch WrRegFn[k] {
-		case "speed":
-			if false {
-				log.Print("test", k, v)
-			}
-		}
-		delete(WrRegVal, k)
+	r.Output[n].get(h)
+	err = DoI2cRpc()
+	if err != nil {
+		return "error", err
 	}
-	return nil
+	fanTrayLedWritten[i] = ledColor(o, i)
+	fanTrayLedShows[i] = ledColor(s[0].D[0], i)
+	return w, nil
 }
 
 func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
-	_, p := WrRegFn[args.Field]
-	if !p {
-		return fmt.Errorf("cannot hset: %s", args.Field)
-	}
-	_, q := WrRegRng[args.Field]
-	if !q {
-		err := i.set(args.Field, string(args.Value), false)
-		if err == nil {
-			*reply = 1
-			WrRegVal[args.Field] = string(args.Value)
-		}
-		return err
-	}
-	var a [2]int
-	var e [2]error
-	if len(WrRegRng[args.Field]) == 2 {
-		for i, v := range WrRegRng[args.Field] {
-			a[i], e[i] = strconv.Atoi(v)
-		}
-		if e[0] == nil && e[1] == nil {
-			val, err := strconv.Atoi(string(args.Value))
-			if err != nil {
-				return err
-			}
-			if val >= a[0] && val <= a[1] {
-				err := i.set(args.Field,
-					string(args.Value), false)
-				if err == nil {
-					*reply = 1
-					WrRegVal[args.Field] =
-						string(args.Value)
-				}
-				return err
-			}
-			return fmt.Errorf("Cannot hset.  Valid range is: %s",
-				WrRegRng[args.Field])
-		}
-	}
-	for _, v := range WrRegRng[args.Field] {
-		if v == string(args.Value) {
-			err := i.set(args.Field, string(args.Value), false)
-			if err == nil {
-				*reply = 1
-				WrRegVal[args.Field] = string(args.Value)
-			}
-			return err
-		}
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
 	}
-	return fmt.Errorf("Cannot hset.  Valid values are: %s",
-		WrRegRng[args.Field])
-}
-
-func (i *Info) set(key, value string, isReadyEvent bool) error {
-	i.pub.Print(key, ": ", value)
-	return nil
+	return err
 }
 
 func (i *Info) publish(key string, value interface{}) {
-	i.pub.Print(key, ": ", value)
+	i.d.Publish(key, value)
 }
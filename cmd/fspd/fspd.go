@@ -10,18 +10,15 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math"
-	"net/rpc"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/platinasystems/atsock"
-	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/goes-bmc/cmd/powerd"
 	"github.com/platinasystems/goes/cmd"
-	"github.com/platinasystems/goes/external/redis"
-	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/external/redis/rpc/args"
 	"github.com/platinasystems/goes/external/redis/rpc/reply"
 	"github.com/platinasystems/goes/lang"
@@ -35,11 +32,6 @@ var (
 
 	VpageByKey map[string]uint8
 
-	WrRegDv  = make(map[string]string)
-	WrRegFn  = make(map[string]string)
-	WrRegVal = make(map[string]string)
-	WrRegRng = make(map[string][]string)
-
 	command *Command
 )
 
@@ -52,15 +44,46 @@ type Command struct {
 	Info
 	Init func()
 	init sync.Once
+
+	energy *Energy
+	saved  time.Time
 }
 
 type Info struct {
 	mutex sync.Mutex
-	rpc   *atsock.RpcServer
-	pub   *publisher.Publisher
-	last  map[string]float64
-	lasts map[string]string
-	lastu map[string]uint16
+	d     *daemon.Daemon
+}
+
+func init() {
+	daemon.Writable("fspd",
+		adminStateKey(1),
+		adminStateKey(2),
+		daemon.Key{
+			Name:   "psu.powercycle",
+			Type:   daemon.EnumKey,
+			Values: []string{"true"},
+			Set: func(interface{}) error {
+				return powerd.Request("cycle")
+			},
+		},
+	)
+}
+
+func adminStateKey(slot int) daemon.Key {
+	return daemon.Key{
+		Name:   "psu" + strconv.Itoa(slot) + ".admin.state",
+		Type:   daemon.EnumKey,
+		Values: []string{"disable", "enable"},
+		Set: func(v interface{}) error {
+			for i := range Vdev {
+				if Vdev[i].Slot == slot {
+					Vdev[i].SetAdminState(v.(string))
+					return nil
+				}
+			}
+			return fmt.Errorf("psu%d: not found", slot)
+		},
+	}
 }
 
 type I2cDev struct {
@@ -75,6 +98,8 @@ type I2cDev struct {
 	GpioPrsntL string
 	GpioPwronL string
 	GpioIntL   string
+	Blackbox   int
+	PoutMax    float64
 	Update     [3]bool
 	Delete     bool
 }
@@ -92,52 +117,69 @@ func (*Command) Apropos() lang.Alt {
 func (*Command) Kind() cmd.Kind { return cmd.Daemon }
 
 func (c *Command) Main(...string) error {
-	var si syscall.Sysinfo_t
-
 	command = c
 	c.init.Do(c.Init)
 
-	err := redis.IsReady()
-	if err != nil {
-		return err
-	}
-
-	c.last = make(map[string]float64)
-	c.lasts = make(map[string]string)
-	c.lastu = make(map[string]uint16)
-
-	if c.pub, err = publisher.New(); err != nil {
+	c.d = daemon.New("fspd")
+	if err := c.d.Start(&c.Info); err != nil {
 		return err
 	}
 
-	if err = syscall.Sysinfo(&si); err != nil {
-		return err
+	update, monitor := 1*time.Second, 5*time.Second
+	if err := c.interrupts(); err != nil {
+		log.Print("notice: fspd: polling, ", err)
+	} else {
+		update, monitor = 10*time.Second, 30*time.Second
 	}
 
-	if c.rpc, err = atsock.NewRpcServer("fspd"); err != nil {
-		return err
-	}
+	err := c.d.Run(
+		daemon.Ticker{Name: "update", Interval: update, Func: c.update},
+		daemon.Ticker{Name: "monitor", Interval: monitor, Func: c.updateMon},
+		daemon.Ticker{Name: "energy", Interval: 5 * time.Second, Func: c.updateEnergy},
+	)
+	c.d.Check("energy save", c.saveEnergy())
+	return err
+}
 
-	rpc.Register(&c.Info)
-	for _, v := range WrRegDv {
-		err = redis.Assign(redis.DefaultHash+":"+v+".", "fspd", "Info")
+// interrupts handles insertion and removal of each psu and its SMBALERT#
+// as they happen, so that the tickers need only catch what was missed.
+func (c *Command) interrupts() error {
+	for i := range Vdev {
+		h := &Vdev[i]
+		if h.GpioPrsntL == "" || h.GpioIntL == "" {
+			continue
+		}
+		err := c.d.OnEdge(h.GpioPrsntL, daemon.Both,
+			func(string) error { return c.update() })
+		if err != nil {
+			return err
+		}
+		err = c.d.OnEdge(h.GpioIntL, daemon.Falling,
+			func(string) error { return c.alert(h) })
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	t := time.NewTicker(1 * time.Second)
-	tm := time.NewTicker(5 * time.Second)
-	for {
-		select {
-		case <-goes.Stop:
-			return nil
-		case <-t.C:
-			c.update()
-		case <-tm.C:
-			c.updateMon()
-		}
+// alert logs the status of a psu that asserted SMBALERT#, publishes its
+// monitored values, then clears its faults so that it may alert again.
+func (c *Command) alert(h *I2cDev) error {
+	if readStopped() == 1 || h.Installed == 0 {
+		return nil
+	}
+	w, err := h.StatusWord()
+	if err != nil {
+		return err
 	}
+	psu := "psu" + strconv.Itoa(h.Slot)
+	eventlog.Record(eventlog.Warning, "fspd", psu+".status_word", "",
+		fmt.Sprintf("%#04x", w), "%s alert, status word %#04x", psu, w)
+	if err = c.updateMon(); err != nil {
+		return err
+	}
+	return h.ClearFaults()
 }
 
 func (c *Command) update() error {
@@ -145,9 +187,6 @@ func (c *Command) update() error {
 	if stopped == 1 {
 		return nil
 	}
-	if err := writeRegs(); err != nil {
-		return err
-	}
 
 	for k, i := range VpageByKey {
 		pin, found := gpio.FindPin(Vdev[i].GpioPrsntL)
@@ -156,58 +195,50 @@ func (c *Command) update() error {
 			//not present
 			if strings.Contains(k, "status") {
 				v := Vdev[i].PsuStatus()
-				if v != c.lasts[k] {
-					c.pub.Print(k, ": ", v)
-					c.lasts[k] = v
-				}
+				c.d.Changed(k, v)
 			}
 			if strings.Contains(k, "admin.state") {
 				v := Vdev[i].GetAdminState()
-				if v != c.lasts[k] {
-					c.pub.Print(k, ": ", v)
-					c.lasts[k] = v
-				}
+				c.d.Changed(k, v)
 			}
 			if Vdev[i].Delete {
 				k := "psu" + strconv.Itoa(Vdev[i].Slot) + ".eeprom"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".sn"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".fan_speed.units.rpm"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".i_out.units.A"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".mfg_id"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".mfg_model"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".p_in.units.W"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".p_out.units.W"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".temp1.units.C"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".temp2.units.C"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".fan_direction"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".v_out.units.V"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
 				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".v_in.units.V"
-				c.pub.Print("delete: ", k)
-				c.lasts[k] = ""
+				c.d.Delete(k)
+				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".p_out_max.units.W"
+				c.d.Delete(k)
+				k = "psu" + strconv.Itoa(Vdev[i].Slot) + ".energy_in.units.Wh"
+				c.d.Delete(k)
+				for _, k := range []string{"fw_rev", "mfr_date", "blackbox"} {
+					c.d.Delete("psu" + strconv.Itoa(Vdev[i].Slot) + "." + k)
+				}
+				for k := range (&Fru{}).Keys() {
+					c.d.Delete("psu" + strconv.Itoa(Vdev[i].Slot) + "." + k)
+				}
+				Vdev[i].PoutMax = 0
 				Vdev[i].Delete = false
 			}
 
@@ -217,18 +248,16 @@ func (c *Command) update() error {
 		} else {
 			//present
 			if strings.Contains(k, "status") {
+				old, found := c.d.Last(k)
 				v := Vdev[i].PsuStatus()
-				if v != c.lasts[k] {
-					c.pub.Print(k, ": ", v)
-					c.lasts[k] = v
+				c.d.Changed(k, v)
+				if found && old != v && v == "powered_off" {
+					c.recordPowerOff(&Vdev[i])
 				}
 			}
 			if strings.Contains(k, "admin.state") {
 				v := Vdev[i].GetAdminState()
-				if v != c.lasts[k] {
-					c.pub.Print(k, ": ", v)
-					c.lasts[k] = v
-				}
+				c.d.Changed(k, v)
 			}
 			if Vdev[i].Update[0] {
 				if strings.Contains(k, "mfg_id") {
@@ -236,10 +265,7 @@ func (c *Command) update() error {
 					if err != nil {
 						return err
 					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
+					c.d.Changed(k, v)
 					Vdev[i].Update[0] = false
 				}
 			}
@@ -249,10 +275,7 @@ func (c *Command) update() error {
 					if err != nil {
 						return err
 					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
+					c.d.Changed(k, v)
 					Vdev[i].Update[1] = false
 				}
 			}
@@ -262,36 +285,66 @@ func (c *Command) update() error {
 					if err != nil {
 						return err
 					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
+					c.d.Changed(k, v)
 					Vdev[i].Update[2] = false
-					var d string
-					if v[0x38:0x3a] == "52" {
-						d = "back->front"
-					} else {
-						d = "front->back"
-					}
-					k = strings.Replace(k, "eeprom", "fan_direction", 1)
-					if d != c.lasts[k] {
-						c.pub.Print(k, ": ", d)
-						c.lasts[k] = d
-					}
-					sb, err := hex.DecodeString(v[0x5a:0x76])
-					sn := string(sb)
-					if err == nil {
-						k = strings.Replace(k, "fan_direction", "sn", 1)
-						if sn != c.lasts[k] {
-							c.pub.Print(k, ": ", sn)
-							c.lasts[k] = sn
-						}
-					}
+					c.publishFru(&Vdev[i], v)
+					c.d.Check(strings.Replace(k, "eeprom", "mfr", 1),
+						c.publishMfr(&Vdev[i]))
 				}
 			}
 		}
 	}
-	return nil
+	return c.updatePower()
+}
+
+// publishFru publishes the fields of the psu's eeprom, v in hex, and its
+// fan direction and serial number as before.
+func (c *Command) publishFru(h *I2cDev, v string) {
+	psu := "psu" + strconv.Itoa(h.Slot)
+	b, err := hex.DecodeString(v)
+	if err != nil {
+		c.d.Check(psu+".fru", err)
+		return
+	}
+	fru, err := ParseFru(b)
+	c.d.Check(psu+".fru", err)
+	if err != nil {
+		return
+	}
+	for k, v := range fru.Keys() {
+		if v != "" {
+			c.d.Changed(psu+"."+k, v)
+		}
+	}
+	c.d.Changed(psu+".fan_direction", fru.Airflow)
+	if fru.Serial != "" {
+		c.d.Changed(psu+".sn", fru.Serial)
+	}
+}
+
+// monitors maps the part of a VpageByKey key after "psuN." to the reader
+// of its value.
+var monitors = map[string]func(h *I2cDev) daemon.Reader{
+	"page":                func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.Page) },
+	"status_word":         func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.StatusWord) },
+	"status_vout":         func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.StatusVout) },
+	"status_iout":         func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.StatusIout) },
+	"status_input":        func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.StatusInput) },
+	"status_temp":         func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.StatusTemp) },
+	"status_fans":         func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.StatusFans) },
+	"v_in.units.V":        func(h *I2cDev) daemon.Reader { return daemon.String(h.Vin) },
+	"i_in.units.A":        func(h *I2cDev) daemon.Reader { return daemon.String(h.Iin) },
+	"v_out.units.V":       func(h *I2cDev) daemon.Reader { return daemon.String(h.Vout) },
+	"i_out.units.A":       func(h *I2cDev) daemon.Reader { return daemon.String(h.Iout) },
+	"p_out.units.W":       func(h *I2cDev) daemon.Reader { return daemon.String(h.Pout) },
+	"p_in.units.W":        func(h *I2cDev) daemon.Reader { return daemon.String(h.Pin) },
+	"p_out_raw":           func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.PoutRaw) },
+	"p_in_raw":            func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.PinRaw) },
+	"p_mode_raw":          func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.ModeRaw) },
+	"pmbus_rev":           func(h *I2cDev) daemon.Reader { return daemon.Uint16(h.PMBusRev) },
+	"temp1.units.C":       func(h *I2cDev) daemon.Reader { return daemon.String(h.Temp1) },
+	"temp2.units.C":       func(h *I2cDev) daemon.Reader { return daemon.String(h.Temp2) },
+	"fan_speed.units.rpm": func(h *I2cDev) daemon.Reader { return daemon.String(h.FanSpeed) },
 }
 
 func (c *Command) updateMon() error {
@@ -299,225 +352,30 @@ func (c *Command) updateMon() error {
 	if stopped == 1 {
 		return nil
 	}
-	if err := writeRegs(); err != nil {
-		return err
-	}
 
+	var sensors []daemon.Sensor
 	for k, i := range VpageByKey {
-
 		pin, found := gpio.FindPin(Vdev[i].GpioPrsntL)
 		t, err := pin.Value()
-		if !found || err != nil || t {
-			// PSU not present
-			return nil
-		} else {
-			// PSU present
-			if Vdev[i].Id != "" {
-				if strings.Contains(k, "page") {
-					v, err := Vdev[i].Page()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "status_word") {
-					v, err := Vdev[i].StatusWord()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "status_vout") {
-					v, err := Vdev[i].StatusVout()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "status_iout") {
-					v, err := Vdev[i].StatusIout()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "status_input") {
-					v, err := Vdev[i].StatusInput()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "v_in") {
-					v, err := Vdev[i].Vin()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "i_in") {
-					v, err := Vdev[i].Iin()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "v_out") {
-					v, err := Vdev[i].Vout()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "i_out") {
-					v, err := Vdev[i].Iout()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "status_temp") {
-					v, err := Vdev[i].StatusTemp()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "p_out") {
-					v, err := Vdev[i].Pout()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "p_in") {
-					v, err := Vdev[i].Pin()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "p_out_raw") {
-					v, err := Vdev[i].PoutRaw()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "p_in_raw") {
-					v, err := Vdev[i].PinRaw()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "p_mode_raw") {
-					v, err := Vdev[i].ModeRaw()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "pmbus_rev") {
-					v, err := Vdev[i].PMBusRev()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "status_fans") {
-					v, err := Vdev[i].StatusFans()
-					if err != nil {
-						return err
-					}
-					if v != c.lastu[k] {
-						c.pub.Print(k, ": ", v)
-						c.lastu[k] = v
-					}
-				}
-				if strings.Contains(k, "temp1") {
-					v, err := Vdev[i].Temp1()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "temp2") {
-					v, err := Vdev[i].Temp2()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-				if strings.Contains(k, "fan_speed.units.rpm") {
-					v, err := Vdev[i].FanSpeed()
-					if err != nil {
-						return err
-					}
-					if v != c.lasts[k] {
-						c.pub.Print(k, ": ", v)
-						c.lasts[k] = v
-					}
-				}
-			}
-
+		if !found || err != nil || t || Vdev[i].Id == "" {
+			// PSU not present or not yet identified
+			continue
+		}
+		dot := strings.Index(k, ".")
+		if dot < 0 {
+			continue
+		}
+		if f, found := monitors[k[dot+1:]]; found {
+			sensors = append(sensors, daemon.Sensor{
+				Key:  k,
+				Read: f(&Vdev[i]),
+			})
 		}
 	}
-	return nil
+	if err := c.d.Poll(sensors); err != nil {
+		return err
+	}
+	return c.updatePower()
 }
 
 func (h *I2cDev) convertVoutMode(voutMode uint8, vout uint16) float64 {
@@ -615,6 +473,13 @@ func (h *I2cDev) PageWr(i uint16) error {
 	return nil
 }
 
+// ClearFaults clears the latched status bits and releases SMBALERT#.
+func (h *I2cDev) ClearFaults() error {
+	r := getRegs()
+	r.ClearFaults.send(h)
+	return DoI2cRpc()
+}
+
 func (h *I2cDev) StatusWord() (uint16, error) {
 	r := getRegs()
 	r.StatusWord.get(h)
@@ -848,6 +713,18 @@ func (h *I2cDev) Pin() (string, error) {
 	return strconv.FormatFloat(v, 'f', 3, 64), nil
 }
 
+// MfrPoutMax returns the rated output power, MFR_POUT_MAX, in watts.
+func (h *I2cDev) MfrPoutMax() (float64, error) {
+	r := getRegs()
+	r.MfrPoutMax.get(h)
+	err := DoI2cRpc()
+	if err != nil {
+		return 0, err
+	}
+	t := uint16(s[0].D[0]) + (uint16(s[0].D[1]) << 8)
+	return h.convert(t)
+}
+
 func (h *I2cDev) PoutRaw() (uint16, error) {
 	r := getRegs()
 	r.Pout.get(h)
@@ -992,17 +869,22 @@ func (h *I2cDev) PsuStatus() string {
 	return "powered_on"
 }
 
+// SetAdminState enables or disables the supply's output. powerd follows
+// the host off, or on, if this changes whether any supply is enabled.
 func (h *I2cDev) SetAdminState(s string) {
 	pin, found := gpio.FindPin(h.GpioPwronL)
 	if found {
 		switch s {
 		case "disable":
 			pin.SetValue(true)
-			log.Print("notice: psu", h.Slot, " ", s)
 		case "enable":
 			pin.SetValue(false)
-			log.Print("notice: psu", h.Slot, " ", s)
+		default:
+			return
 		}
+		eventlog.Record(eventlog.Notice, "fspd",
+			"psu"+strconv.Itoa(h.Slot)+".admin.state", "", s,
+			"psu%d %s", h.Slot, s)
 	}
 }
 
@@ -1021,122 +903,14 @@ func (h *I2cDev) GetAdminState() string {
 	return "enabled"
 }
 
-func powerCycle() error {
-
-	stopI2c()
-	time.Sleep(500 * time.Millisecond)
-
-	log.Print("initiate manual power cycle")
-	pin, found := gpio.FindPin("PSU0_PWRON_L")
-	if found {
-		pin.SetValue(true)
-	}
-	pin, found = gpio.FindPin("PSU1_PWRON_L")
-	if found {
-		pin.SetValue(true)
-	}
-	time.Sleep(1 * time.Second)
-	pin, found = gpio.FindPin("PSU0_PWRON_L")
-	if found {
-		pin.SetValue(false)
-	}
-	pin, found = gpio.FindPin("PSU1_PWRON_L")
-	if found {
-		pin.SetValue(false)
-	}
-	time.Sleep(1 * time.Second)
-	pin, found = gpio.FindPin("ETHX_RST_L")
-	if found {
-		pin.SetValue(false)
-		time.Sleep(50 * time.Millisecond)
-		pin.SetValue(true)
-	}
-	startI2c()
-	return nil
-}
-
-func writeRegs() error {
-	for k, v := range WrRegVal {
-		switch WrRegFn[k] {
-		case "example":
-			//check for psuX when writing
-			if false {
-				log.Print("test", k, v)
-			}
-		case "powercycle":
-			if v == "true" {
-				powerCycle()
-			}
-		case "admin.state":
-			if strings.Contains(k, "psu1") {
-				Vdev[1].SetAdminState(v)
-			} else if strings.Contains(k, "psu2") {
-				Vdev[0].SetAdminState(v)
-			}
-		}
-		delete(WrRegVal, k)
-	}
-	return nil
-}
-
 func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
-	_, p := WrRegFn[args.Field]
-	if !p {
-		return fmt.Errorf("cannot hset: %s", args.Field)
-	}
-	_, q := WrRegRng[args.Field]
-	if !q {
-		err := i.set(args.Field, string(args.Value), false)
-		if err == nil {
-			*reply = 1
-			WrRegVal[args.Field] = string(args.Value)
-		}
-		return err
-	}
-	var a [2]int
-	var e [2]error
-	if len(WrRegRng[args.Field]) == 2 {
-		for i, v := range WrRegRng[args.Field] {
-			a[i], e[i] = strconv.Atoi(v)
-		}
-		if e[0] == nil && e[1] == nil {
-			val, err := strconv.Atoi(string(args.Value))
-			if err != nil {
-				return err
-			}
-			if val >= a[0] && val <= a[1] {
-				err := i.set(args.Field,
-					string(args.Value), false)
-				if err == nil {
-					*reply = 1
-					WrRegVal[args.Field] =
-						string(args.Value)
-				}
-				return err
-			}
-			return fmt.Errorf("Cannot hset.  Valid range is: %s",
-				WrRegRng[args.Field])
-		}
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
 	}
-	for _, v := range WrRegRng[args.Field] {
-		if v == string(args.Value) {
-			err := i.set(args.Field, string(args.Value), false)
-			if err == nil {
-				*reply = 1
-				WrRegVal[args.Field] = string(args.Value)
-			}
-			return err
-		}
-	}
-	return fmt.Errorf("Cannot hset.  Valid values are: %s",
-		WrRegRng[args.Field])
-}
-
-func (i *Info) set(key, value string, isReadyEvent bool) error {
-	i.pub.Print(key, ": ", value)
-	return nil
+	return err
 }
 
 func (i *Info) publish(key string, value interface{}) {
-	i.pub.Print(key, ": ", value)
+	i.d.Publish(key, value)
 }
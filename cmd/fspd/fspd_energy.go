@@ -0,0 +1,221 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fspd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnergyFile keeps the energy counters across restarts; /etc is on /perm.
+var EnergyFile = "/etc/goes/energy.json"
+
+// energySave is how often the counters are written to flash.
+const energySave = 10 * time.Minute
+
+// Energy is the input energy metered by fspd: that of the supply in each
+// slot, which restarts when a supply with another serial number is
+// installed, and the chassis total, which doesn't.
+type Energy struct {
+	Psu   map[string]*PsuEnergy
+	Total float64
+}
+
+type PsuEnergy struct {
+	Serial string
+	Wh     float64
+
+	// the previous READ_EIN, or power sample if unsupported
+	ein   ein
+	w     float64
+	t     time.Time
+	noEin bool
+}
+
+// ein is a PMBus READ_EIN: a 15-bit accumulator of watt-samples that
+// carries into an 8-bit rollover count, and a 24-bit sample count. The
+// accumulator is read as whole watts, the direct format coefficients of
+// the supplies that have it.
+type ein struct {
+	acc     uint32
+	samples uint32
+}
+
+const (
+	einMod     = 0x8000 * 0x100
+	samplesMod = 0x1000000
+)
+
+// parseEin decodes the 6 data bytes of READ_EIN.
+func parseEin(b []byte) (ein, error) {
+	if len(b) != 6 {
+		return ein{}, fmt.Errorf("read_ein: %d bytes", len(b))
+	}
+	acc := uint32(b[0]) | uint32(b[1])<<8
+	if acc > 0x7fff {
+		return ein{}, fmt.Errorf("read_ein: accumulator %#x", acc)
+	}
+	return ein{
+		acc:     uint32(b[2])*0x8000 + acc,
+		samples: uint32(b[3]) | uint32(b[4])<<8 | uint32(b[5])<<16,
+	}, nil
+}
+
+// power returns the average watts since prev, allowing for either count
+// wrapping, and false if there are no new samples.
+func (e ein) power(prev ein) (float64, bool) {
+	n := (e.samples + samplesMod - prev.samples) % samplesMod
+	if n == 0 {
+		return 0, false
+	}
+	acc := (e.acc + einMod - prev.acc) % einMod
+	return float64(acc) / float64(n), true
+}
+
+// Ein returns the READ_EIN accumulator or an error if the psu has none.
+func (h *I2cDev) Ein() (ein, error) {
+	r := getRegs()
+	r.Ein.get(h, 7)
+	err := DoI2cRpc()
+	if err != nil {
+		return ein{}, err
+	}
+	if n := s[0].D[1]; n != 6 {
+		return ein{}, fmt.Errorf("read_ein: %d bytes", n)
+	}
+	return parseEin(s[0].D[2:8])
+}
+
+func loadEnergy() (*Energy, error) {
+	e := &Energy{Psu: make(map[string]*PsuEnergy)}
+	b, err := ioutil.ReadFile(EnergyFile)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(b, e)
+	}
+	if e.Psu == nil {
+		e.Psu = make(map[string]*PsuEnergy)
+	}
+	if err != nil {
+		return e, fmt.Errorf("%s: %w", EnergyFile, err)
+	}
+	return e, nil
+}
+
+func (e *Energy) save() error {
+	b, err := json.MarshalIndent(e, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := EnergyFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, EnergyFile)
+}
+
+// add meters the energy of a psu from its accumulator, or from the power
+// sample w if it has none, since the last call, and returns the watt hours
+// added.
+func (p *PsuEnergy) add(now time.Time, a ein, w float64) float64 {
+	defer func() {
+		p.ein, p.w, p.t = a, w, now
+	}()
+	if p.t.IsZero() {
+		return 0
+	}
+	hours := now.Sub(p.t).Hours()
+	var wh float64
+	if p.noEin {
+		// trapezoid of the power samples
+		wh = (p.w + w) / 2 * hours
+	} else if avg, ok := a.power(p.ein); ok {
+		wh = avg * hours
+	} else {
+		return 0
+	}
+	p.Wh += wh
+	return wh
+}
+
+// updateEnergy meters each psu that is installed and identified, and
+// publishes its psuN.energy_in.units.Wh and the chassis total,
+// power.energy_in.units.Wh.
+func (c *Command) updateEnergy() error {
+	if readStopped() == 1 {
+		return nil
+	}
+	if c.energy == nil {
+		var err error
+		c.energy, err = loadEnergy()
+		c.d.Check("energy load", err)
+		c.saved = time.Now()
+	}
+	now := time.Now()
+	for i := range Vdev {
+		h := &Vdev[i]
+		slot := strconv.Itoa(h.Slot)
+		psu := "psu" + slot
+		p := c.energy.Psu[slot]
+		if h.Installed == 0 || h.Id == "" || h.Update[2] {
+			if p != nil {
+				// don't meter across the gap, nor assume the
+				// next supply is like this one
+				p.t = time.Time{}
+				p.noEin = false
+			}
+			continue
+		}
+		sn, _ := c.d.Last(psu + ".sn")
+		if p == nil || p.Serial != sn {
+			p = &PsuEnergy{Serial: sn}
+			c.energy.Psu[slot] = p
+		}
+		var a ein
+		var w float64
+		if !p.noEin {
+			var err error
+			a, err = h.Ein()
+			if err != nil {
+				if !p.t.IsZero() {
+					return err
+				}
+				// the first read tells whether it's supported
+				p.noEin = true
+			}
+		}
+		if p.noEin {
+			f, err := h.Pin()
+			if err != nil {
+				return err
+			}
+			w, _ = strconv.ParseFloat(f, 64)
+		}
+		c.energy.Total += p.add(now, a, w)
+		c.d.Changed(psu+".energy_in.units.Wh",
+			strconv.FormatFloat(p.Wh, 'f', 3, 64))
+	}
+	c.d.Changed("power.energy_in.units.Wh",
+		strconv.FormatFloat(c.energy.Total, 'f', 3, 64))
+	if now.Sub(c.saved) >= energySave {
+		return c.saveEnergy()
+	}
+	return nil
+}
+
+// saveEnergy writes the energy counters to EnergyFile.
+func (c *Command) saveEnergy() error {
+	if c.energy == nil {
+		return nil
+	}
+	c.saved = time.Now()
+	return c.energy.save()
+}
@@ -0,0 +1,54 @@
+package fspd
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEinPower(t *testing.T) {
+	prev, err := parseEin([]byte{0x00, 0x7f, 0xff, 0xfe, 0xff, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// accumulator and rollover count wrap, 0x100 + 0x10 samples later
+	e, err := parseEin([]byte{0x00, 0x01, 0x00, 0x0e, 0x01, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := e.power(prev)
+	if !ok {
+		t.Fatal("no samples")
+	}
+	want := float64(0x100+0x8000-0x7f00) / 0x110
+	if w != want {
+		t.Errorf("got %v W, want %v", w, want)
+	}
+	if _, ok = e.power(e); ok {
+		t.Error("power without new samples")
+	}
+	if _, err = parseEin([]byte{0xff, 0xff, 0, 0, 0, 0}); err == nil {
+		t.Error("accumulator over 15 bits")
+	}
+	if _, err = parseEin([]byte{0, 0}); err == nil {
+		t.Error("short read")
+	}
+}
+
+func TestEnergyAdd(t *testing.T) {
+	t0 := time.Unix(0, 0)
+	p := &PsuEnergy{noEin: true}
+	p.add(t0, ein{}, 100)
+	p.add(t0.Add(30*time.Minute), ein{}, 300)
+	p.add(t0.Add(90*time.Minute), ein{}, 300)
+	if math.Abs(p.Wh-400) > 1e-9 {
+		t.Errorf("samples: got %v Wh, want 400", p.Wh)
+	}
+
+	p = &PsuEnergy{}
+	p.add(t0, ein{acc: 0, samples: 0}, 0)
+	p.add(t0.Add(time.Hour), ein{acc: 2000, samples: 10}, 0)
+	if math.Abs(p.Wh-200) > 1e-9 {
+		t.Errorf("read_ein: got %v Wh, want 200", p.Wh)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fspd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Fru is what the psu eeprom says of the supply. Fields that the eeprom
+// doesn't have are empty.
+type Fru struct {
+	Manufacturer string
+	PartNumber   string
+	Revision     string
+	Serial       string
+	Date         string
+	Airflow      string
+}
+
+// Keys returns the psuN.fru.* keys of f, named after the fields.
+func (f *Fru) Keys() map[string]string {
+	return map[string]string{
+		"fru.manufacturer": f.Manufacturer,
+		"fru.part_number":  f.PartNumber,
+		"fru.revision":     f.Revision,
+		"fru.serial":       f.Serial,
+		"fru.date":         f.Date,
+		"fru.airflow":      f.Airflow,
+	}
+}
+
+// Offsets of the vendor layout that predates the IPMI header on the psus
+// qualified for this bmc, and that still sets the airflow on those that
+// have the header: 'R' for back to front.
+const (
+	vendorAirflow   = 0x1c
+	vendorSerial    = 0x2d
+	vendorSerialEnd = 0x3b
+)
+
+// fruEpoch is the zero of the IPMI FRU manufacture date, in minutes.
+var fruEpoch = time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var errNoFru = errors.New("no fru")
+
+// ParseFru decodes a psu eeprom, either IPMI FRU, with the common header,
+// board and product areas, or the vendor layout. Malformed eeproms return
+// an error, never a partial Fru.
+func ParseFru(b []byte) (*Fru, error) {
+	if len(b) <= vendorAirflow {
+		return nil, fmt.Errorf("fru: %d bytes", len(b))
+	}
+	f := &Fru{Airflow: "front->back"}
+	if b[vendorAirflow] == 'R' {
+		f.Airflow = "back->front"
+	}
+	err := f.parseIpmi(b)
+	if err == errNoFru {
+		err = f.parseVendor(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Fru) parseIpmi(b []byte) error {
+	if len(b) < 8 || b[0] != 1 {
+		return errNoFru
+	}
+	if checksum(b[:8]) != 0 {
+		return errNoFru
+	}
+	if off := int(b[3]) * 8; off != 0 {
+		area, err := fruArea(b, off, "board")
+		if err != nil {
+			return err
+		}
+		// version, length, language, then the 3 byte date
+		if len(area) < 6 {
+			return fmt.Errorf("fru: board area: %d bytes", len(area))
+		}
+		minutes := int(area[3]) | int(area[4])<<8 | int(area[5])<<16
+		if minutes != 0 {
+			t := fruEpoch.Add(time.Duration(minutes) * time.Minute)
+			f.Date = t.Format(time.RFC3339)
+		}
+		fields, err := fruFields(area[6:], "board")
+		if err != nil {
+			return err
+		}
+		// manufacturer, product, serial, part number
+		f.Manufacturer = field(fields, 0)
+		f.Serial = field(fields, 2)
+		f.PartNumber = field(fields, 3)
+	}
+	if off := int(b[4]) * 8; off != 0 {
+		area, err := fruArea(b, off, "product")
+		if err != nil {
+			return err
+		}
+		if len(area) < 3 {
+			return fmt.Errorf("fru: product area: %d bytes", len(area))
+		}
+		fields, err := fruFields(area[3:], "product")
+		if err != nil {
+			return err
+		}
+		// manufacturer, name, part/model, version, serial; these
+		// override the board's
+		for _, x := range []struct {
+			p *string
+			i int
+		}{
+			{&f.Manufacturer, 0},
+			{&f.PartNumber, 2},
+			{&f.Revision, 3},
+			{&f.Serial, 4},
+		} {
+			if s := field(fields, x.i); s != "" {
+				*x.p = s
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fru) parseVendor(b []byte) error {
+	if len(b) < vendorSerialEnd {
+		return fmt.Errorf("fru: %d bytes", len(b))
+	}
+	b = b[vendorSerial:vendorSerialEnd]
+	for len(b) > 0 {
+		if c := b[len(b)-1]; c != ' ' && c != 0 && c != 0xff {
+			break
+		}
+		b = b[:len(b)-1]
+	}
+	for _, c := range b {
+		if c < ' ' || c > '~' {
+			return fmt.Errorf("fru: serial %q", b)
+		}
+	}
+	sn := string(b)
+	f.Serial = sn
+	return nil
+}
+
+// fruArea returns the area at off, checking its length and checksum.
+func fruArea(b []byte, off int, name string) ([]byte, error) {
+	if off+2 > len(b) {
+		return nil, fmt.Errorf("fru: %s area at %#x: past end", name,
+			off)
+	}
+	n := int(b[off+1]) * 8
+	if n == 0 || off+n > len(b) {
+		return nil, fmt.Errorf("fru: %s area at %#x: %d bytes", name,
+			off, n)
+	}
+	area := b[off : off+n]
+	if checksum(area) != 0 {
+		return nil, fmt.Errorf("fru: %s area: bad checksum", name)
+	}
+	return area, nil
+}
+
+// fruFields decodes type/length fields up to the 0xc1 end marker.
+func fruFields(b []byte, name string) ([]string, error) {
+	var fields []string
+	for len(b) > 0 {
+		tl := b[0]
+		if tl == 0xc1 {
+			return fields, nil
+		}
+		n := int(tl & 0x3f)
+		if 1+n > len(b) {
+			return nil, fmt.Errorf("fru: %s field %d: past end",
+				name, len(fields))
+		}
+		fields = append(fields, decodeField(tl>>6, b[1:1+n]))
+		b = b[1+n:]
+	}
+	return nil, fmt.Errorf("fru: %s area: no end marker", name)
+}
+
+// decodeField decodes the data of a field of the given type: binary,
+// BCD plus, 6-bit packed ASCII or 8-bit ASCII.
+func decodeField(typ byte, b []byte) string {
+	var s string
+	switch typ {
+	case 0:
+		s = hex.EncodeToString(b)
+	case 1:
+		const bcd = "0123456789 -.???"
+		for _, c := range b {
+			s += string(bcd[c>>4]) + string(bcd[c&0xf])
+		}
+	case 2:
+		var buf []byte
+		for i := 0; i+2 < len(b); i += 3 {
+			v := uint32(b[i]) | uint32(b[i+1])<<8 | uint32(b[i+2])<<16
+			for j := uint(0); j < 4; j++ {
+				buf = append(buf, byte(v>>(6*j)&0x3f)+' ')
+			}
+		}
+		s = string(buf)
+	default:
+		buf := make([]byte, 0, len(b))
+		for _, c := range b {
+			if c >= ' ' && c <= '~' {
+				buf = append(buf, c)
+			}
+		}
+		s = string(buf)
+	}
+	return strings.TrimSpace(s)
+}
+
+func field(fields []string, i int) string {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return ""
+}
+
+func checksum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return sum
+}
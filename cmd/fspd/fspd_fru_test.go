@@ -0,0 +1,127 @@
+package fspd
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// ipmiFru returns a 256 byte eeprom with a board and product area.
+func ipmiFru() []byte {
+	ascii := func(s string) []byte {
+		return append([]byte{0xc0 | byte(len(s))}, s...)
+	}
+	area := func(hdr []byte, fields ...[]byte) []byte {
+		b := append([]byte(nil), hdr...)
+		for _, f := range fields {
+			b = append(b, f...)
+		}
+		b = append(b, 0xc1)
+		for (len(b)+1)%8 != 0 {
+			b = append(b, 0)
+		}
+		b[1] = byte((len(b) + 1) / 8)
+		return append(b, -checksum(b))
+	}
+	// 2019-03-04T10:20:00Z is 12187340 minutes after 1996
+	board := area([]byte{1, 0, 0, 0xcc, 0xf6, 0xb9},
+		ascii("Acme"), ascii("PSU550"), ascii("B123"), ascii("P-550"),
+		ascii(""))
+	product := area([]byte{1, 0, 0},
+		ascii("Acme Power"), ascii("PSU550"), ascii("P-550-R"),
+		ascii("A02"), ascii("S0001234"), ascii(""), ascii(""))
+	b := make([]byte, 256)
+	hdr := []byte{1, 0, 0, 1, byte(1 + len(board)/8), 0, 0}
+	copy(b, append(hdr, -checksum(hdr)))
+	copy(b[8:], board)
+	copy(b[8+len(board):], product)
+	return b
+}
+
+func TestParseFruIpmi(t *testing.T) {
+	b := ipmiFru()
+	f, err := ParseFru(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Fru{
+		Manufacturer: "Acme Power",
+		PartNumber:   "P-550-R",
+		Revision:     "A02",
+		Serial:       "S0001234",
+		Date:         "2019-03-04T10:20:00Z",
+		Airflow:      "front->back",
+	}
+	if *f != want {
+		t.Errorf("got %+v\nwant %+v", *f, want)
+	}
+}
+
+func TestParseFruVendor(t *testing.T) {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = 0xff
+	}
+	b[vendorAirflow] = 'R'
+	copy(b[vendorSerial:], "ABC123")
+	f, err := ParseFru(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Serial != "ABC123" || f.Airflow != "back->front" {
+		t.Errorf("got %+v", *f)
+	}
+}
+
+func TestParseFruMalformed(t *testing.T) {
+	for _, x := range []struct {
+		name string
+		edit func(b []byte) []byte
+	}{
+		{"short", func(b []byte) []byte { return b[:16] }},
+		{"empty", func(b []byte) []byte { return nil }},
+		{"board checksum", func(b []byte) []byte {
+			b[20]++
+			return b
+		}},
+		{"board past end", func(b []byte) []byte {
+			b[3] = 0x1f
+			b[7] = -checksum(b[:7])
+			return b
+		}},
+		{"area length", func(b []byte) []byte {
+			b[9] = 0xff
+			return b
+		}},
+		{"vendor serial", func(b []byte) []byte {
+			b[0] = 0
+			b[vendorSerial] = 0x80
+			return b
+		}},
+	} {
+		if f, err := ParseFru(x.edit(ipmiFru())); err == nil {
+			t.Errorf("%s: no error, got %+v", x.name, *f)
+		}
+	}
+}
+
+// TestParseFruRandom checks that random and randomly corrupted eeproms
+// return a Fru or an error rather than panic.
+func TestParseFruRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		var b []byte
+		if i%2 == 0 {
+			b = make([]byte, r.Intn(300))
+			r.Read(b)
+		} else {
+			b = ipmiFru()[:r.Intn(257)]
+			for n := r.Intn(4); n >= 0 && len(b) > 0; n-- {
+				b[r.Intn(len(b))] = byte(r.Intn(256))
+			}
+		}
+		f, err := ParseFru(b)
+		if err == nil && f == nil {
+			t.Fatalf("%x: nil Fru without error", b)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fspd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/i2c"
+)
+
+// mfrString returns the printable part of a PMBus manufacturer block, or
+// "" if the supply doesn't support it.
+func mfrString(b []byte) string {
+	buf := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c >= ' ' && c <= '~' {
+			buf = append(buf, c)
+		}
+	}
+	t := strings.TrimSpace(string(buf))
+	if t == "Not Supported" {
+		return ""
+	}
+	return t
+}
+
+// MfrRevision returns the supply's MFR_REVISION, its firmware revision.
+func (h *I2cDev) MfrRevision() (string, error) {
+	r := getRegs()
+	r.MfrRevision.get(h, i2c.SMBusMax)
+	if err := DoI2cRpc(); err != nil {
+		return "", err
+	}
+	return mfrString(blockData()), nil
+}
+
+// MfrDate returns the supply's MFR_DATE.
+func (h *I2cDev) MfrDate() (string, error) {
+	r := getRegs()
+	r.MfrDate.get(h, i2c.SMBusMax)
+	if err := DoI2cRpc(); err != nil {
+		return "", err
+	}
+	return mfrString(blockData()), nil
+}
+
+// BlackBox returns the status registers latched by the supply and, if the
+// board names its command, the vendor's fault record in hex.
+func (h *I2cDev) BlackBox() (string, error) {
+	w, err := h.StatusWord()
+	if err != nil {
+		return "", err
+	}
+	bb := fmt.Sprintf("status_word=%#04x", w)
+	for _, x := range []struct {
+		name string
+		f    func() (uint16, error)
+	}{
+		{"vout", h.StatusVout},
+		{"iout", h.StatusIout},
+		{"input", h.StatusInput},
+		{"temp", h.StatusTemp},
+		{"fans", h.StatusFans},
+	} {
+		v, err := x.f()
+		if err != nil {
+			return "", err
+		}
+		bb += fmt.Sprintf(" %s=%#02x", x.name, v)
+	}
+	if h.Blackbox != 0 {
+		block(h, uint8(h.Blackbox), i2c.SMBusMax)
+		if err = DoI2cRpc(); err != nil {
+			return "", err
+		}
+		bb += " mfr=" + hex.EncodeToString(blockData())
+	}
+	return bb, nil
+}
+
+// publishMfr publishes the firmware revision and manufacture date of a
+// newly identified supply, and its black box.
+func (c *Command) publishMfr(h *I2cDev) error {
+	psu := "psu" + strconv.Itoa(h.Slot)
+	rev, err := h.MfrRevision()
+	if err != nil {
+		return err
+	}
+	date, err := h.MfrDate()
+	if err != nil {
+		return err
+	}
+	if rev != "" {
+		c.d.Changed(psu+".fw_rev", rev)
+	}
+	if date != "" {
+		c.d.Changed(psu+".mfr_date", date)
+	}
+	bb, err := h.BlackBox()
+	if err != nil {
+		return err
+	}
+	c.d.Changed(psu+".blackbox", bb)
+	return nil
+}
+
+// recordPowerOff copies the black box and firmware revision of a supply
+// that has just powered off to the event log, for its RMA.
+func (c *Command) recordPowerOff(h *I2cDev) {
+	psu := "psu" + strconv.Itoa(h.Slot)
+	rev, _ := c.d.Last(psu + ".fw_rev")
+	sn, _ := c.d.Last(psu + ".sn")
+	bb, err := h.BlackBox()
+	if err != nil {
+		bb = "unreadable: " + err.Error()
+	} else {
+		c.d.Changed(psu+".blackbox", bb)
+	}
+	eventlog.Record(eventlog.Warning, "fspd", psu+".blackbox", "", bb,
+		"%s powered off, sn %q fw_rev %q: %s", psu, sn, rev, bb)
+}
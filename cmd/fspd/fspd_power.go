@@ -0,0 +1,129 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fspd
+
+import (
+	"strconv"
+
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+)
+
+// States of power.redundancy: ok while any one supply may fail, degraded
+// while one supply carries the load and lost with none.
+const (
+	redundancyOk       = "ok"
+	redundancyDegraded = "degraded"
+	redundancyLost     = "lost"
+)
+
+// States of power.budget: ok while one supply can carry the load,
+// exceeded when losing a supply would drop it and unknown while a supply's
+// rating is, or no supply is good.
+const (
+	budgetOk       = "ok"
+	budgetExceeded = "exceeded"
+	budgetUnknown  = "unknown"
+)
+
+func redundancy(good int) string {
+	switch good {
+	case 0:
+		return redundancyLost
+	case 1:
+		return redundancyDegraded
+	}
+	return redundancyOk
+}
+
+// ratingUnknown is the PoutMax of a supply without MFR_POUT_MAX, which is
+// optional in PMBus.
+const ratingUnknown = -1
+
+// budget compares the total load of the good supplies with the smallest
+// of their ratings. With only one good supply, losing it drops the load.
+func budget(good int, load, rating float64) string {
+	switch {
+	case good == 0:
+		return budgetUnknown
+	case good == 1:
+		return budgetExceeded
+	case rating <= 0:
+		return budgetUnknown
+	case load > rating:
+		return budgetExceeded
+	}
+	return budgetOk
+}
+
+// updatePower publishes the redundancy of the supplies that are installed,
+// enabled and powered on, and whether either could carry their load alone.
+func (c *Command) updatePower() error {
+	var good int
+	var load, rating float64
+	unrated := false
+	for i := range Vdev {
+		h := &Vdev[i]
+		psu := "psu" + strconv.Itoa(h.Slot)
+		status, _ := c.d.Last(psu + ".status")
+		admin, _ := c.d.Last(psu + ".admin.state")
+		if status != "powered_on" || admin != "enabled" {
+			continue
+		}
+		good++
+		if h.PoutMax == 0 && h.Id != "" {
+			// read once per supply, even if it fails
+			f, err := h.MfrPoutMax()
+			c.d.Check(psu+".p_out_max", err)
+			if err != nil {
+				h.PoutMax = ratingUnknown
+				c.d.Changed(psu+".p_out_max.units.W", budgetUnknown)
+			} else {
+				h.PoutMax = f
+				c.d.Changed(psu+".p_out_max.units.W", f)
+			}
+		}
+		if h.PoutMax <= 0 {
+			unrated = true
+		} else if rating == 0 || h.PoutMax < rating {
+			rating = h.PoutMax
+		}
+		s, _ := c.d.Last(psu + ".p_out.units.W")
+		f, _ := strconv.ParseFloat(s, 64)
+		load += f
+	}
+
+	old, _ := c.d.Last("power.redundancy")
+	r := redundancy(good)
+	if c.d.Changed("power.redundancy", r) && old != "" {
+		sev := eventlog.Notice
+		if r != redundancyOk {
+			sev = eventlog.Warning
+		}
+		eventlog.Record(sev, "fspd", "power.redundancy", old, r,
+			"power redundancy %s", r)
+	}
+
+	c.d.Changed("power.load.units.W", strconv.FormatFloat(load, 'f', 0, 64))
+	old, _ = c.d.Last("power.budget")
+	if unrated {
+		rating = 0
+	}
+	b := budget(good, load, rating)
+	if !c.d.Changed("power.budget", b) {
+		return nil
+	}
+	if b == budgetExceeded && good == 1 {
+		eventlog.Record(eventlog.Warning, "fspd", "power.budget", old, b,
+			"power load %.0fW on one supply", load)
+	} else if b == budgetExceeded {
+		eventlog.Record(eventlog.Warning, "fspd", "power.budget", old, b,
+			"power load %.0fW exceeds %.0fW of one supply", load,
+			rating)
+	} else if old == budgetExceeded {
+		eventlog.Record(eventlog.Notice, "fspd", "power.budget", old, b,
+			"power load %.0fW within one supply", load)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package fspd
+
+import "testing"
+
+func TestRedundancy(t *testing.T) {
+	for _, x := range []struct {
+		good int
+		want string
+	}{
+		{0, redundancyLost},
+		{1, redundancyDegraded},
+		{2, redundancyOk},
+	} {
+		if got := redundancy(x.good); got != x.want {
+			t.Errorf("redundancy(%d) = %q, want %q", x.good, got, x.want)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	for _, x := range []struct {
+		good         int
+		load, rating float64
+		want         string
+	}{
+		{2, 300, 0, budgetUnknown},
+		{2, 300, 550, budgetOk},
+		{2, 550, 550, budgetOk},
+		{2, 600, 550, budgetExceeded},
+		{1, 100, 550, budgetExceeded},
+		{0, 0, 0, budgetUnknown},
+	} {
+		if got := budget(x.good, x.load, x.rating); got != x.want {
+			t.Errorf("budget(%d, %v, %v) = %q, want %q",
+				x.good, x.load, x.rating, got, x.want)
+		}
+	}
+}
@@ -36,9 +36,9 @@ type regs struct {
 	StatusFans  reg8 // 0x81
 	_           byte
 	_           [0x04 * 2]byte
-	Ein         reg8 // 0x86
+	Ein         reg8b // 0x86
 	_           byte
-	Eout        reg8 // 0x87
+	Eout        reg8b // 0x87
 	_           byte
 	Vin         reg16r // 0x88
 	Iin         reg16r // 0x89
@@ -58,6 +58,14 @@ type regs struct {
 	_           byte
 	MfgMod      reg8b // 0x9a
 	_           byte
+	MfrRevision reg8b // 0x9b
+	_           byte
+	MfrLocation reg8b // 0x9c
+	_           byte
+	MfrDate     reg8b // 0x9d
+	_           byte
+	_           [0x09 * 2]byte
+	MfrPoutMax  reg16r // 0xa7
 }
 
 type regsE struct {
@@ -5,15 +5,13 @@
 package fspd
 
 import (
-	"net/rpc"
-	"time"
 	"unsafe"
 
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
 	"github.com/platinasystems/i2c"
-	"github.com/platinasystems/log"
 )
 
-const MAXOPS = 30
+const MAXOPS = daemon.MAXOPS
 
 type I struct {
 	InUse     bool
@@ -30,8 +28,6 @@ type R struct {
 	E error
 }
 
-type I2cReq int
-
 var b = [i2c.BlockMax]byte{0}
 var i = I{false, i2c.RW(0), 0, 0, b, 0, 0, 0}
 var j [MAXOPS]I
@@ -43,9 +39,6 @@ var dummy byte
 var regsPointer = unsafe.Pointer(&dummy)
 var regsAddr = uintptr(unsafe.Pointer(&dummy))
 
-var clientA *rpc.Client
-var dialed int = 0
-
 // offset function has divide by two for 16-bit offset struct
 func getRegs() *regs {
 	clearJ()
@@ -77,6 +70,26 @@ func (r *reg8b) get(h *I2cDev, readLen byte) {
 	x++
 }
 
+// block reads a PMBus block command that isn't in regs, such as a
+// manufacturer specific one.
+func block(h *I2cDev, cmd uint8, readLen byte) {
+	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
+
+	data[0] = readLen
+	j[x] = I{true, i2c.Read, cmd, i2c.I2CBlockData, data, h.Bus, h.Addr, 0}
+	x++
+}
+
+// blockData returns the data of a block read by the last DoI2cRpc, less
+// its byte count.
+func blockData() []byte {
+	n := int(s[0].D[1])
+	if n > i2c.SMBusMax-1 {
+		n = i2c.SMBusMax - 1
+	}
+	return append([]byte(nil), s[0].D[2:2+n]...)
+}
+
 func (r *reg32B) get(h *I2cDev) {
 	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
 
@@ -107,6 +120,14 @@ func (r *reg8) set(h *I2cDev, v uint8) {
 	x++
 }
 
+// send writes the command code alone, as for CLEAR_FAULTS.
+func (r *reg8) send(h *I2cDev) {
+	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
+
+	j[x] = I{true, i2c.Write, r.offset(), i2c.Byte, data, h.Bus, h.Addr, 0}
+	x++
+}
+
 func (r *reg16) set(h *I2cDev, v uint16) {
 	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
 
@@ -133,49 +154,22 @@ func clearJ() {
 }
 
 func readStopped() byte {
-	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
-	j[0] = I{true, i2c.Write, 0, i2c.ByteData, data, int(0x98), int(0), 0}
-	err := DoI2cRpc()
-	if err != nil {
+	if daemon.Stopped() {
 		return 1
 	}
-	return s[0].D[0]
+	return 0
 }
 
 func stopI2c() error {
-	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
-	j[0] = I{true, i2c.Write, 0, 0, data, int(0x99), int(1), 0}
-	err := DoI2cRpc()
-	if err != nil {
-		return err
-	}
-	return nil
+	return daemon.StopI2c()
 }
 
 func startI2c() error {
-	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
-	j[0] = I{true, i2c.Write, 0, 0, data, int(0x99), int(0), 0}
-	err := DoI2cRpc()
-	if err != nil {
-		return err
-	}
-	return nil
+	return daemon.StartI2c()
 }
 
 func DoI2cRpc() error {
-	if dialed == 0 {
-		client, err := rpc.DialHTTP("tcp", "127.0.0.1"+":1233")
-		if err != nil {
-			log.Print("dialing:", err)
-			return err
-		}
-		clientA = client
-		dialed = 1
-		time.Sleep(time.Millisecond * time.Duration(50))
-	}
-	err := clientA.Call("I2cReq.ReadWrite", &j, &s)
-	if err != nil {
-		log.Print("i2cReq error:", err)
+	if err := daemon.I2cRpc(&j, &s); err != nil {
 		return err
 	}
 	clearJ()
@@ -0,0 +1,104 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package history
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/platinasystems/atsock"
+	"github.com/platinasystems/goes-bmc/cmd/historyd"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/parms"
+)
+
+const DfltSince = "1h"
+
+type Command struct{}
+
+func (Command) String() string { return "history" }
+
+func (Command) Usage() string { return "history [KEY [-since DURATION]]" }
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "display sensor history",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	The history command displays the values recorded by historyd.
+
+	Without KEY, the recorded keys are listed.
+
+	The -since parameter specifies how far back to go, default 1h.
+	Raw samples are shown when available, otherwise the min, max and
+	average of each minute or hour.
+
+EXAMPLES
+	history hwmon.front.temp.units.C
+	history fan_tray.1.1.speed.units.rpm -since 24h`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	parm, args := parms.New(args, "-since")
+	if len(parm.ByName["-since"]) == 0 {
+		parm.ByName["-since"] = DfltSince
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("%v: unexpected", args[1:])
+	}
+	since, err := time.ParseDuration(parm.ByName["-since"])
+	if err != nil {
+		return err
+	}
+
+	client, err := atsock.NewRpcClient("historyd")
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if len(args) == 0 {
+		var keys []string
+		if err = client.Call("Info.Keys", struct{}{}, &keys); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			fmt.Println(k)
+		}
+		return nil
+	}
+
+	var reply historyd.QueryReply
+	err = client.Call("Info.Query", historyd.QueryArgs{
+		Key:   args[0],
+		Since: time.Now().Add(-since).Unix(),
+	}, &reply)
+	if err != nil {
+		return err
+	}
+	if reply.Step == 0 {
+		for _, p := range reply.Points {
+			fmt.Printf("%s %g\n", stamp(p.T), p.Avg)
+		}
+		return nil
+	}
+	fmt.Printf("%-25s %10s %10s %10s %6s\n", "time", "min", "max", "avg",
+		"count")
+	for _, p := range reply.Points {
+		fmt.Printf("%-25s %10.3f %10.3f %10.3f %6d\n", stamp(p.T),
+			p.Min, p.Max, p.Avg, p.N)
+	}
+	return nil
+}
+
+func stamp(t int64) string {
+	return time.Unix(t, 0).Format(time.RFC3339)
+}
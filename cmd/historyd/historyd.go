@@ -0,0 +1,341 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package historyd records the history of published sensor readings.
+package historyd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/rpc"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redigo "github.com/garyburd/redigo/redis"
+	"github.com/platinasystems/atsock"
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes-bmc/cmd/mmclogd"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/log"
+)
+
+const (
+	SPILLDIR       = mmclogd.MMCDIR + "/history"
+	SPILLA         = SPILLDIR + "/history.csv"
+	SPILLB         = SPILLDIR + "/history2.csv"
+	MAXSPILL int64 = 64 * 1024 * 1024
+)
+
+// MaxKeys limits the number of keys recorded; keys first published after
+// that are ignored.
+var MaxKeys = 256
+
+type Command struct {
+	Info
+	Init func()
+	init sync.Once
+}
+
+type Info struct {
+	mutex  sync.Mutex
+	rpc    *atsock.RpcServer
+	series map[string]*Series
+	spill  bytes.Buffer
+	full   bool
+}
+
+type QueryArgs struct {
+	Key   string
+	Since int64
+}
+
+type QueryReply struct {
+	Step   int64
+	Points []Point
+}
+
+func (*Command) String() string { return "historyd" }
+
+func (*Command) Usage() string { return "historyd" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "sensor history daemon",
+	}
+}
+
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	historyd records the numeric values published to redis, of up to
+	` + strconv.Itoa(MaxKeys) + ` keys.
+
+	Each key keeps the last ` + strconv.Itoa(RawSamples) + ` raw samples,
+	one minute min/max/avg summaries for a day and one hour summaries
+	for thirty days.
+
+	When mmclogd has mounted the MMC card, raw samples are also
+	appended to ` + SPILLA + `. historyd replays them when it starts,
+	so that the history, summaries included, survives a restart.
+
+	See the history command to query it.`,
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(...string) error {
+	if c.Init != nil {
+		c.init.Do(c.Init)
+	}
+
+	err := redis.IsReady()
+	if err != nil {
+		return err
+	}
+
+	c.series = make(map[string]*Series)
+	if _, err = os.Stat(mmclogd.ENABLE); err == nil {
+		for _, fn := range []string{SPILLB, SPILLA} {
+			if err = c.load(fn); err != nil {
+				log.Print("historyd: ", err)
+			}
+		}
+	}
+
+	if c.rpc, err = atsock.NewRpcServer("historyd"); err != nil {
+		return err
+	}
+	rpc.Register(&c.Info)
+
+	go c.subscribe()
+
+	t := time.NewTicker(60 * time.Second)
+	for {
+		select {
+		case <-goes.Stop:
+			c.flush()
+			return nil
+		case <-t.C:
+			if err = c.flush(); err != nil {
+				log.Print("historyd: ", err)
+			}
+		}
+	}
+}
+
+// subscribe records the messages published to redis, resubscribing if
+// the connection is lost.
+func (i *Info) subscribe() {
+	for {
+		psc, err := redis.Subscribe(redis.DefaultHash)
+		if err == nil {
+			err = i.receive(psc)
+			psc.Close()
+		}
+		log.Print("historyd: ", err, "; resubscribing")
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (i *Info) receive(psc redigo.PubSubConn) error {
+	for {
+		switch t := psc.Receive().(type) {
+		case redigo.Message:
+			i.record(time.Now(), string(t.Data))
+		case error:
+			return t
+		}
+	}
+}
+
+// record adds a "key: value" message if the value is numeric.
+func (i *Info) record(t time.Time, msg string) {
+	kv := strings.SplitN(msg, ": ", 2)
+	if len(kv) != 2 || kv[0] == "delete" {
+		return
+	}
+	v, ok := parseValue(kv[1])
+	if !ok {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.add(t, kv[0], v) {
+		fmt.Fprintf(&i.spill, "%d,%s,%s\n", t.Unix(), kv[0], kv[1])
+	}
+}
+
+// add records a sample unless MaxKeys other keys are recorded. The mutex
+// is held.
+func (i *Info) add(t time.Time, key string, v float64) bool {
+	s, found := i.series[key]
+	if !found {
+		if len(i.series) >= MaxKeys {
+			if !i.full {
+				i.full = true
+				log.Print("historyd: ", MaxKeys,
+					" keys recorded; ignoring ", key,
+					" and later keys")
+			}
+			return false
+		}
+		s = NewSeries()
+		i.series[key] = s
+	}
+	s.Add(t, v)
+	return true
+}
+
+// load replays the raw samples spilled to fn by an earlier run.
+func (i *Info) load(fn string) error {
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.SplitN(scan.Text(), ",", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		t, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if v, ok := parseValue(fields[2]); ok {
+			i.add(time.Unix(t, 0), fields[1], v)
+		}
+	}
+	return scan.Err()
+}
+
+func parseValue(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// flush appends buffered raw samples to the MMC card, if mounted.
+func (i *Info) flush() error {
+	i.mutex.Lock()
+	b := append([]byte(nil), i.spill.Bytes()...)
+	i.spill.Reset()
+	i.mutex.Unlock()
+
+	if _, err := os.Stat(mmclogd.ENABLE); os.IsNotExist(err) {
+		return nil
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(SPILLDIR); os.IsNotExist(err) {
+		if err = os.Mkdir(SPILLDIR, 0755); err != nil {
+			return err
+		}
+	}
+	mode := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	f, err := os.OpenFile(SPILLA, mode, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(SPILLA)
+	if err != nil {
+		return err
+	}
+	if fi.Size() > MAXSPILL {
+		return os.Rename(SPILLA, SPILLB)
+	}
+	return nil
+}
+
+// Query returns the history of a key since the given unix time. Raw samples
+// are read back from the MMC card when those in memory don't reach back far
+// enough.
+func (i *Info) Query(args QueryArgs, reply *QueryReply) error {
+	i.mutex.Lock()
+	s, found := i.series[args.Key]
+	if found {
+		reply.Points, reply.Step = s.Query(time.Unix(args.Since, 0))
+	}
+	i.mutex.Unlock()
+	if len(reply.Points) > 0 && reply.Points[0].T <= args.Since {
+		return nil
+	}
+	if reply.Step != 0 {
+		return nil
+	}
+	var before int64 = 1<<63 - 1
+	if len(reply.Points) > 0 {
+		before = reply.Points[0].T
+	}
+	var spilled []Point
+	for _, fn := range []string{SPILLB, SPILLA} {
+		spilled = append(spilled,
+			readSpill(fn, args.Key, args.Since, before)...)
+	}
+	reply.Points = append(spilled, reply.Points...)
+	if len(reply.Points) == 0 && !found {
+		return fmt.Errorf("%s: no history", args.Key)
+	}
+	return nil
+}
+
+func readSpill(fn, key string, since, before int64) (p []Point) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.SplitN(scan.Text(), ",", 3)
+		if len(fields) != 3 || fields[1] != key {
+			continue
+		}
+		t, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || t < since || t >= before {
+			continue
+		}
+		if v, ok := parseValue(fields[2]); ok {
+			p = append(p, Point{T: t, Min: v, Max: v, Avg: v, N: 1})
+		}
+	}
+	return
+}
+
+// Keys lists the recorded keys.
+func (i *Info) Keys(args struct{}, reply *[]string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for k := range i.series {
+		*reply = append(*reply, k)
+	}
+	sort.Strings(*reply)
+	return nil
+}
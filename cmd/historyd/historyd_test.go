@@ -0,0 +1,94 @@
+package historyd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSeriesTiers(t *testing.T) {
+	defer func(n int) { RawSamples = n }(RawSamples)
+	RawSamples = 10
+
+	s := NewSeries()
+	t0 := time.Unix(3600*1000, 0)
+	for i := 0; i < 180; i++ {
+		s.Add(t0.Add(time.Duration(i)*time.Second), float64(i%60))
+	}
+
+	p, step := s.Query(t0.Add(175 * time.Second))
+	if step != 0 || len(p) != 5 || p[0].Avg != 55 {
+		t.Errorf("raw query: step %d, %v", step, p)
+	}
+
+	p, step = s.Query(t0)
+	if step != 60 || len(p) != 3 {
+		t.Fatalf("minute query: step %d, %v", step, p)
+	}
+	for _, b := range p {
+		if b.Min != 0 || b.Max != 59 || b.Avg != 29.5 || b.N != 60 {
+			t.Errorf("minute bucket: %+v", b)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	i := &Info{series: make(map[string]*Series)}
+	now := time.Now()
+	i.record(now, "fan_tray.duty: 0x80")
+	i.record(now, "hwmon.front.temp.units.C: 31.250")
+	i.record(now, "fan_tray.1.status: ok.front->back")
+	i.record(now, "delete: psu1.sn")
+	if len(i.series) != 2 {
+		t.Fatalf("recorded %d keys, want 2", len(i.series))
+	}
+	defer func(n int) { MaxKeys = n }(MaxKeys)
+	MaxKeys = 2
+	i.record(now, "fan_tray.speed: 5000")
+	if _, found := i.series["fan_tray.speed"]; found {
+		t.Error("recorded more than MaxKeys")
+	}
+	var reply QueryReply
+	err := i.Query(QueryArgs{"fan_tray.duty", now.Unix()}, &reply)
+	if err != nil || len(reply.Points) != 1 || reply.Points[0].Avg != 128 {
+		t.Errorf("query: %v %+v", err, reply)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "historyd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(n int) { RawSamples = n }(RawSamples)
+	RawSamples = 10
+
+	// three minutes of samples spilled by an earlier run
+	var spill []byte
+	t0 := int64(3600 * 1000)
+	for i := int64(0); i < 180; i++ {
+		spill = append(spill, fmt.Sprintf("%d,fan_tray.duty,%d\n",
+			t0+i, i%60)...)
+	}
+	fn := filepath.Join(dir, "history.csv")
+	if err = ioutil.WriteFile(fn, spill, 0644); err != nil {
+		t.Fatal(err)
+	}
+	i := &Info{series: make(map[string]*Series)}
+	if err = i.load(fn); err != nil {
+		t.Fatal(err)
+	}
+	if i.spill.Len() != 0 {
+		t.Error("loaded samples spilled again")
+	}
+	var reply QueryReply
+	err = i.Query(QueryArgs{"fan_tray.duty", t0}, &reply)
+	if err != nil || reply.Step != 60 || len(reply.Points) != 3 ||
+		reply.Points[0].N != 60 || reply.Points[0].Max != 59 {
+		t.Errorf("minute summaries after load: %v %+v", err, reply)
+	}
+}
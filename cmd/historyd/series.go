@@ -0,0 +1,152 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package historyd
+
+import (
+	"math"
+	"time"
+)
+
+// Point is a raw sample when N is 1, otherwise the min/max/avg summary of N
+// samples in the Step long bucket starting at T.
+type Point struct {
+	T   int64
+	Min float64
+	Max float64
+	Avg float64
+	N   int
+}
+
+// ring holds the last size points. It grows as they come, so that keys
+// published rarely, or not for long, don't cost a full ring.
+type ring struct {
+	p    []Point
+	size int
+	next int
+}
+
+func newRing(n int) *ring { return &ring{size: n} }
+
+func (r *ring) full() bool { return len(r.p) == r.size }
+
+func (r *ring) push(p Point) {
+	if !r.full() {
+		if len(r.p) == cap(r.p) {
+			n := 2 * cap(r.p)
+			if n < 16 {
+				n = 16
+			}
+			if n > r.size {
+				n = r.size
+			}
+			r.p = append(make([]Point, 0, n), r.p...)
+		}
+		r.p = append(r.p, p)
+		return
+	}
+	r.p[r.next] = p
+	r.next = (r.next + 1) % r.size
+}
+
+// points returns the ring contents oldest first.
+func (r *ring) points() []Point {
+	return append(append([]Point(nil), r.p[r.next:]...), r.p[:r.next]...)
+}
+
+func (r *ring) oldest() (Point, bool) {
+	if len(r.p) == 0 {
+		return Point{}, false
+	}
+	return r.p[r.next], true
+}
+
+type tier struct {
+	step int64
+	cur  Point
+	sum  float64
+	*ring
+}
+
+func (t *tier) add(ts int64, v float64) {
+	start := ts - ts%t.step
+	if t.cur.N > 0 && start != t.cur.T {
+		t.flush()
+	}
+	if t.cur.N == 0 {
+		t.cur = Point{T: start, Min: v, Max: v}
+		t.sum = 0
+	}
+	t.cur.Min = math.Min(t.cur.Min, v)
+	t.cur.Max = math.Max(t.cur.Max, v)
+	t.sum += v
+	t.cur.N++
+	t.cur.Avg = t.sum / float64(t.cur.N)
+}
+
+func (t *tier) flush() {
+	if t.cur.N > 0 {
+		t.push(t.cur)
+		t.cur = Point{}
+	}
+}
+
+// current returns the completed buckets plus the one being filled.
+func (t *tier) current() []Point {
+	p := t.points()
+	if t.cur.N > 0 {
+		p = append(p, t.cur)
+	}
+	return p
+}
+
+// Tiers are raw samples, one minute and one hour summaries.
+var (
+	RawSamples  = 720
+	MinuteSteps = 24 * 60
+	HourSteps   = 30 * 24
+)
+
+// Series is the history of one key.
+type Series struct {
+	raw *ring
+	min *tier
+	hr  *tier
+}
+
+func NewSeries() *Series {
+	return &Series{
+		raw: newRing(RawSamples),
+		min: &tier{step: 60, ring: newRing(MinuteSteps)},
+		hr:  &tier{step: 3600, ring: newRing(HourSteps)},
+	}
+}
+
+func (s *Series) Add(t time.Time, v float64) {
+	ts := t.Unix()
+	s.raw.push(Point{T: ts, Min: v, Max: v, Avg: v, N: 1})
+	s.min.add(ts, v)
+	s.hr.add(ts, v)
+}
+
+// Query returns the finest resolution covering since, and its step in
+// seconds; step is zero for raw samples.
+func (s *Series) Query(since time.Time) ([]Point, int64) {
+	ts := since.Unix()
+	var p []Point
+	var step int64
+	if o, ok := s.raw.oldest(); !ok || o.T <= ts || !s.raw.full() {
+		p = s.raw.points()
+	} else if o, ok := s.min.oldest(); !ok || o.T <= ts || !s.min.full() {
+		p, step = s.min.current(), s.min.step
+	} else {
+		p, step = s.hr.current(), s.hr.step
+	}
+	for i := range p {
+		if p[i].T+step >= ts {
+			return p[i:], step
+		}
+	}
+	return nil, step
+}
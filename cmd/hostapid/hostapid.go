@@ -0,0 +1,369 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package hostapid serves the host agents' heartbeats, temperatures and
+// boot progress over HTTPS, authenticated with a bearer token, so that the
+// host needn't write the bmc's redis.
+package hostapid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/external/redis/rpc/args"
+	"github.com/platinasystems/goes/external/redis/rpc/reply"
+	"github.com/platinasystems/goes/lang"
+)
+
+var (
+	Addr      = ":8443"
+	TokenFile = "/etc/goes/hostapi.token"
+	CertFile  = "/etc/goes/hostapi.crt"
+	KeyFile   = "/etc/goes/hostapi.key"
+)
+
+// maxBody limits the size of a request.
+const maxBody = 4096
+
+func init() {
+	daemon.Writable("hostapid",
+		daemon.Key{
+			Name: "host.boot.progress",
+			Type: daemon.TextKey,
+			Set: func(v interface{}) error {
+				eventlog.Record(eventlog.Notice, "hostapid",
+					"host.boot.progress", "", v.(string),
+					"host boot progress %s", v)
+				return nil
+			},
+		},
+	)
+}
+
+type Command struct {
+	Info
+	Init func()
+	init sync.Once
+}
+
+type Info struct {
+	mutex sync.Mutex
+	d     *daemon.Daemon
+}
+
+func (*Command) String() string { return "hostapid" }
+
+func (*Command) Usage() string { return "hostapid" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "host agent api daemon",
+	}
+}
+
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	hostapid accepts JSON POSTs from the host's agents over HTTPS on
+	` + Addr + `, each with the header "Authorization: Bearer TOKEN",
+	where TOKEN is the content of ` + TokenFile + `. The token and
+	a self-signed certificate, ` + CertFile + `, are created on
+	first start; agents should trust only that certificate so the token
+	isn't sent to anything else.
+
+	/v1/heartbeat	{"Sequence": "42"}
+		kicks the host watchdog, if enabled
+	/v1/temperature	{"Host": 61.5, "Qsfp": 48}
+		sets host.temp.units.C and qsfp.temp.units.C for the fan
+		control of w83795d; either may be omitted
+	/v1/boot	{"Progress": "os"}
+		sets host.boot.progress
+
+	e.g.
+	curl --cacert hostapi.crt -H "Authorization: Bearer $(cat token)" \
+		-d '{"Host": 61.5}' https://bmc:8443/v1/temperature
+
+	Success is 204 No Content.`,
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(...string) error {
+	if c.Init != nil {
+		c.init.Do(c.Init)
+	}
+
+	c.d = daemon.New("hostapid")
+	if err := c.d.Start(&c.Info); err != nil {
+		return err
+	}
+
+	token, err := loadToken(TokenFile)
+	if err != nil {
+		return err
+	}
+	cert, err := loadCert(CertFile, KeyFile)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", Addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler: &Server{
+			Token: token,
+			Hset: func(key, value string) error {
+				_, err := redis.Hset(redis.DefaultHash, key, value)
+				return err
+			},
+			Hget: func(key string) (string, error) {
+				return redis.Hget(redis.DefaultHash, key)
+			},
+		},
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	serve := make(chan error, 1)
+	go func() {
+		serve <- srv.ServeTLS(ln, "", "")
+	}()
+	defer srv.Close()
+
+	run := make(chan error, 1)
+	go func() {
+		run <- c.d.Run()
+	}()
+	select {
+	case err = <-serve:
+		return fmt.Errorf("serve: %w", err)
+	case err = <-run:
+		return err
+	}
+}
+
+// loadToken returns the token in fn, first creating it if it doesn't exist.
+func loadToken(fn string) (string, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err == nil {
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return "", fmt.Errorf("%s: empty", fn)
+		}
+		return token, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	buf := make([]byte, 16)
+	if _, err = rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err = ioutil.WriteFile(fn, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// loadCert returns the certificate in certFn and keyFn, first creating a
+// self-signed one if either doesn't exist.
+func loadCert(certFn, keyFn string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFn, keyFn)
+	if err == nil || !os.IsNotExist(err) {
+		return cert, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return cert, err
+	}
+	max := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return cert, err
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "bmc"
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(20, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl,
+		&key.PublicKey, key)
+	if err != nil {
+		return cert, err
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return cert, err
+	}
+	kpem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY",
+		Bytes: kder})
+	if err = ioutil.WriteFile(keyFn, kpem, 0600); err != nil {
+		return cert, err
+	}
+	cpem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = ioutil.WriteFile(certFn, cpem, 0644); err != nil {
+		return cert, err
+	}
+	return tls.X509KeyPair(cpem, kpem)
+}
+
+// Message is the body of a POST: Sequence for heartbeats, Host and Qsfp
+// for temperatures in °C, and Progress for boot progress.
+type Message struct {
+	Sequence string
+	Host     *float64
+	Qsfp     *float64
+	Progress string
+}
+
+// errRejected marks errors of the daemons that own the keys.
+var errRejected = errors.New("rejected")
+
+// Server handles the api with Hset and Hget of the redis keys that the host
+// used to write directly.
+type Server struct {
+	Token string
+	Hset  func(key, value string) error
+	Hget  func(key string) (string, error)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var f func(*Message) error
+	switch r.URL.Path {
+	case "/v1/heartbeat":
+		f = s.heartbeat
+	case "/v1/temperature":
+		f = s.temperature
+	case "/v1/boot":
+		f = s.boot
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	var m Message
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).
+		Decode(&m)
+	if err == nil {
+		err = f(&m)
+	}
+	if errors.Is(err, errRejected) {
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	const bearer = "Bearer "
+	h := r.Header.Get("Authorization")
+	if s.Token == "" || !strings.HasPrefix(h, bearer) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(h[len(bearer):]),
+		[]byte(s.Token)) == 1
+}
+
+func (s *Server) hset(key, value string) error {
+	if err := s.Hset(key, value); err != nil {
+		return fmt.Errorf("%s: %v: %w", key, err, errRejected)
+	}
+	return nil
+}
+
+func (s *Server) heartbeat(m *Message) error {
+	if v, _ := s.Hget("watchdog.enable"); v != "true" {
+		return nil
+	}
+	seq := m.Sequence
+	if seq == "" {
+		seq = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	return s.hset("watchdog.sequence", seq)
+}
+
+func (s *Server) temperature(m *Message) error {
+	if m.Host == nil && m.Qsfp == nil {
+		return errors.New("no temperature")
+	}
+	for _, x := range []struct {
+		key string
+		t   *float64
+	}{
+		{"host.temp.units.C", m.Host},
+		{"qsfp.temp.units.C", m.Qsfp},
+	} {
+		if x.t == nil {
+			continue
+		}
+		err := s.hset(x.key, strconv.FormatFloat(*x.t, 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) boot(m *Message) error {
+	if m.Progress == "" {
+		return errors.New("no progress")
+	}
+	return s.hset("host.boot.progress", m.Progress)
+}
+
+func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package hostapid
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	keys := map[string]string{"watchdog.enable": "true"}
+	s := &Server{
+		Token: "secret",
+		Hset: func(key, value string) error {
+			if key == "qsfp.temp.units.C" && value == "300" {
+				return errors.New("out of range")
+			}
+			keys[key] = value
+			return nil
+		},
+		Hget: func(key string) (string, error) {
+			return keys[key], nil
+		},
+	}
+	for _, x := range []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{"POST", "/v1/heartbeat", "secret", `{"Sequence":"7"}`, 204},
+		{"POST", "/v1/temperature", "secret", `{"Host":61.5}`, 204},
+		{"POST", "/v1/boot", "secret", `{"Progress":"os"}`, 204},
+		{"POST", "/v1/boot", "wrong", `{"Progress":"bios"}`, 401},
+		{"POST", "/v1/boot", "", `{"Progress":"bios"}`, 401},
+		{"GET", "/v1/boot", "secret", ``, 405},
+		{"POST", "/v1/reset", "secret", `{}`, 404},
+		{"POST", "/v1/temperature", "secret", `{}`, 400},
+		{"POST", "/v1/temperature", "secret", `{"Host":`, 400},
+		{"POST", "/v1/temperature", "secret", `{"Qsfp":300}`, 409},
+	} {
+		r := httptest.NewRequest(x.method, x.path,
+			strings.NewReader(x.body))
+		if x.token != "" {
+			r.Header.Set("Authorization", "Bearer "+x.token)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != x.status {
+			t.Errorf("%s %s %s: got %d, want %d", x.method, x.path,
+				x.body, w.Code, x.status)
+		}
+	}
+	for k, v := range map[string]string{
+		"watchdog.sequence":  "7",
+		"host.temp.units.C":  "61.5",
+		"host.boot.progress": "os",
+	} {
+		if keys[k] != v {
+			t.Errorf("%s: got %q, want %q", k, keys[k], v)
+		}
+	}
+	if _, found := keys["qsfp.temp.units.C"]; found {
+		t.Error("qsfp.temp.units.C set")
+	}
+	keys["watchdog.enable"] = "false"
+	r := httptest.NewRequest("POST", "/v1/heartbeat",
+		strings.NewReader(`{"Sequence":"8"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	s.ServeHTTP(httptest.NewRecorder(), r)
+	if keys["watchdog.sequence"] != "7" {
+		t.Error("disabled watchdog kicked")
+	}
+}
+
+func TestLoadCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostapid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFn := filepath.Join(dir, "hostapi.crt")
+	keyFn := filepath.Join(dir, "hostapi.key")
+	first, err := loadCert(certFn, keyFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(keyFn); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("key mode %v", fi.Mode().Perm())
+	}
+	again, err := loadCert(certFn, keyFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Certificate[0], again.Certificate[0]) {
+		t.Error("certificate recreated")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"strings"
 
+	"github.com/platinasystems/goes-bmc/cmd/netcfg"
 	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/parms"
 )
@@ -25,7 +26,7 @@ func (Command) Usage() string { return "ipcfg [-ip]" }
 
 func (Command) Apropos() lang.Alt {
 	return lang.Alt{
-		lang.EnUS: "set the bmc ip address, via bootargs ip=",
+		lang.EnUS: "set the bmc legacy ip address, see netcfg",
 	}
 }
 
@@ -41,6 +42,9 @@ DESCRIPTION
 		The value is stored in the "ip" string in u-boot "bootargs"
 		environment variable in legacy firmware versions.
 
+		The IPv4 settings of the netcfg configuration and the start
+		script are updated to match; use netcfg for everything else.
+
 		Example:
 		ipcfg -ip 192.168.101.241::192.168.101.2:255.255.255.0::eth0:on`,
 	}
@@ -73,6 +77,19 @@ func dispIP() error {
 }
 
 func updateIP(ip string) (err error) {
+	c, err := netcfg.Load()
+	if err != nil {
+		return err
+	}
+	l := netcfg.ParseLegacy(ip)
+	c.IPv4 = l.IPv4
+	c.Gateway4 = l.Gateway4
+	if l.Hostname != "" {
+		c.Hostname = l.Hostname
+	}
+	if err = c.Save(); err != nil {
+		return err
+	}
 	err = ioutil.WriteFile("/boot/"+Machine+"-per.bin",
 		[]byte(ip+"\x00"), 0644)
 	return
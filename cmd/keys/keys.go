@@ -0,0 +1,68 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package keys extends the goes keys command to list the keys that the bmc
+// daemons accept from hset.
+package keys
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/platinasystems/flags"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes/cmd/keys"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct {
+	keys.Command
+}
+
+func (Command) Usage() string { return "keys [-writable] [PATTERN]" }
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Print the redis keys matching PATTERN.
+
+	With -writable, print the fields of the default hash that may be
+	set with hset, along with their type, accepted values and daemon.
+	Definitions that the daemon would reject are flagged.`,
+	}
+}
+
+func (c Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-writable")
+	if !flag.ByName["-writable"] {
+		return c.Command.Main(args...)
+	}
+	pattern := ".*"
+	switch len(args) {
+	case 0:
+	case 1:
+		pattern = args[0]
+	default:
+		return fmt.Errorf("%v: unexpected", args[1:])
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range daemon.Daemons() {
+		keys := daemon.Schema(name)
+		if err := daemon.CheckSchema(name, keys); err != nil {
+			fmt.Printf("%s: invalid schema: %v\n", name, err)
+		}
+		for _, k := range keys {
+			if !re.MatchString(k.Name) {
+				continue
+			}
+			fmt.Printf("%-32s %-8v %-24s %s\n",
+				k.Name, k.Type, k.Range(), name)
+		}
+	}
+	return nil
+}
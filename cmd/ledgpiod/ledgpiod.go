@@ -6,19 +6,15 @@
 package ledgpiod
 
 import (
-	"fmt"
-	"net/rpc"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/platinasystems/atsock"
-	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
 	"github.com/platinasystems/goes/cmd"
 	"github.com/platinasystems/goes/external/redis"
-	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/external/redis/rpc/args"
 	"github.com/platinasystems/goes/external/redis/rpc/reply"
 	"github.com/platinasystems/goes/lang"
@@ -32,24 +28,17 @@ const (
 )
 
 var (
-	lastFanStatus [maxFanTrays]string
-	lastPsuStatus [maxPsu]string
+	lastFanStatus  [maxFanTrays]string
+	lastPsuStatus  [maxPsu]string
+	lastRedundancy string
 
-	psuLed       = []uint8{0x8, 0x10}
-	psuLedYellow = []uint8{0x8, 0x10}
-	psuLedOff    = []uint8{0x04, 0x01}
+	psuLed       = make([]uint8, maxPsu)
+	psuLedYellow = make([]uint8, maxPsu)
+	psuLedOff    = make([]uint8, maxPsu)
 
-	sysLed       byte = 0x1
-	sysLedGreen  byte = 0x1
-	sysLedYellow byte = 0xc
-	sysLedOff    byte = 0x80
+	sysLed, sysLedGreen, sysLedYellow, sysLedOff byte
+	fanLed, fanLedGreen, fanLedYellow, fanLedOff byte
 
-	fanLed       byte = 0x6
-	fanLedGreen  byte = 0x2
-	fanLedYellow byte = 0x6
-	fanLedOff    byte = 0x0
-
-	deviceVer          byte
 	forceFanSpeed      bool
 	systemFanDirection string
 
@@ -58,13 +47,38 @@ var (
 	Vdev I2cDev
 
 	VpageByKey map[string]uint8
+)
 
-	WrRegDv  = make(map[string]string)
-	WrRegFn  = make(map[string]string)
-	WrRegVal = make(map[string]string)
-	WrRegRng = make(map[string][]string)
+// LedBits are the expander output bits of an LED: its mask and their value
+// for each color.
+type LedBits struct {
+	Mask, Green, Yellow, Off byte
+}
+
+// SysLed, FanLed and PsuLed are the front panel LEDs of the board.
+var (
+	SysLed = LedBits{Mask: 0x1, Green: 0x1, Yellow: 0xc, Off: 0x80}
+	FanLed = LedBits{Mask: 0x6, Green: 0x2, Yellow: 0x6, Off: 0x0}
+	PsuLed = []LedBits{
+		{Mask: 0x8, Yellow: 0x8, Off: 0x04},
+		{Mask: 0x10, Yellow: 0x10, Off: 0x01},
+	}
 )
 
+var command *Command
+
+func init() {
+	daemon.Writable("ledgpiod",
+		daemon.Key{
+			Name: "system.identify",
+			Type: daemon.TextKey,
+			Set: func(v interface{}) error {
+				return command.identify(v.(string))
+			},
+		},
+	)
+}
+
 type Command struct {
 	Info
 	Init func()
@@ -73,16 +87,17 @@ type Command struct {
 
 type Info struct {
 	mutex sync.Mutex
-	rpc   *atsock.RpcServer
-	pub   *publisher.Publisher
-	last  map[string]float64
-	lasts map[string]string
-	lastu map[string]uint16
+	d     *daemon.Daemon
 }
 
+// I2cDev is the device. If MuxAddr isn't zero, it's behind that mux on
+// MuxBus, which is set to MuxValue before each access.
 type I2cDev struct {
-	Bus  int
-	Addr int
+	Bus      int
+	Addr     int
+	MuxBus   int
+	MuxAddr  int
+	MuxValue int
 }
 
 func (*Command) String() string { return "ledgpiod" }
@@ -98,55 +113,45 @@ func (*Command) Apropos() lang.Alt {
 func (*Command) Kind() cmd.Kind { return cmd.Daemon }
 
 func (c *Command) Main(...string) error {
-	var si syscall.Sysinfo_t
-
+	command = c
 	if c.Init != nil {
 		c.init.Do(c.Init)
 	}
 
-	err := redis.IsReady()
-	if err != nil {
-		return err
-	}
-
 	first = 1
-
-	c.last = make(map[string]float64)
-	c.lasts = make(map[string]string)
-	c.lastu = make(map[string]uint16)
-
-	if c.pub, err = publisher.New(); err != nil {
-		return err
-	}
-
-	if err = syscall.Sysinfo(&si); err != nil {
-		return err
-	}
-
-	if c.rpc, err = atsock.NewRpcServer("ledgpiod"); err != nil {
+	c.d = daemon.New("ledgpiod")
+	if err := c.d.Start(&c.Info); err != nil {
 		return err
 	}
+	c.d.Publish("system.identify", "false")
 
-	rpc.Register(&c.Info)
-	for _, v := range WrRegDv {
-		err = redis.Assign(redis.DefaultHash+":"+v+".", "ledgpiod", "Info")
-		if err != nil {
-			return err
-		}
-	}
-
-	t := time.NewTicker(2 * time.Second)
-	for {
-		select {
-		case <-goes.Stop:
+	c.d.On(daemon.PowerEvent, func(string) error {
+		if Vdev.Addr == 0 {
 			return nil
-		case <-t.C:
-			if Vdev.Addr != 0 {
-				if err = c.update(); err != nil {
-				}
-			}
 		}
-	}
+		log.Print("notice: re-init front panel LEDs")
+		return Vdev.LedFpReinit()
+	})
+
+	return c.d.Run(daemon.Ticker{
+		Name:     "update",
+		Interval: 2 * time.Second,
+		Func: func() error {
+			if Vdev.Addr == 0 {
+				return nil
+			}
+			return c.update()
+		},
+	}, daemon.Ticker{
+		Name:     "blink",
+		Interval: Tick,
+		Func: func() error {
+			if Vdev.Addr == 0 {
+				return nil
+			}
+			return c.blink()
+		},
+	})
 }
 
 func (c *Command) update() error {
@@ -154,9 +159,6 @@ func (c *Command) update() error {
 	if stopped == 1 {
 		return nil
 	}
-	if err := writeRegs(); err != nil {
-		return err
-	}
 
 	if first == 1 {
 		err := Vdev.LedFpInit()
@@ -169,13 +171,15 @@ func (c *Command) update() error {
 	if err != nil {
 		return err
 	}
+	if err = c.readback(); err != nil {
+		return err
+	}
 
 	for k, _ := range VpageByKey {
 		if strings.Contains(k, "fan_direction") {
 			v := Vdev.CheckSystemFans()
-			if (v != "") && (v != c.lasts[k]) {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
+			if v != "" {
+				c.d.Changed(k, v)
 			}
 		}
 	}
@@ -183,6 +187,21 @@ func (c *Command) update() error {
 
 }
 
+// setLeds takes the bits of the LEDs from SysLed, FanLed and PsuLed.
+func setLeds() {
+	sysLed, sysLedGreen = SysLed.Mask, SysLed.Green
+	sysLedYellow, sysLedOff = SysLed.Yellow, SysLed.Off
+	fanLed, fanLedGreen = FanLed.Mask, FanLed.Green
+	fanLedYellow, fanLedOff = FanLed.Yellow, FanLed.Off
+	for j := range psuLed {
+		var l LedBits
+		if j < len(PsuLed) {
+			l = PsuLed[j]
+		}
+		psuLed[j], psuLedYellow[j], psuLedOff[j] = l.Mask, l.Yellow, l.Off
+	}
+}
+
 func (h *I2cDev) LedFpInit() error {
 	var d byte
 
@@ -191,9 +210,7 @@ func (h *I2cDev) LedFpInit() error {
 		pin.SetValue(true)
 	}
 
-	ss, _ := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
-	_, _ = fmt.Sscan(ss, &deviceVer)
-
+	setLeds()
 	forceFanSpeed = false
 
 	r := getRegs()
@@ -229,13 +246,15 @@ func (h *I2cDev) LedFpInit() error {
 	if err != nil {
 		return err
 	}
+	sysLedState.Set(Status, Steady(Green))
+	fanLedState.Set(Status, Steady(Yellow))
+	sysWritten, fanWritten = -1, -1
+	psuWritten = [maxPsu]string{psuShows, psuShows}
 	return nil
 }
 
 func (h *I2cDev) LedFpReinit() error {
-
-	ss, _ := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
-	_, _ = fmt.Sscan(ss, &deviceVer)
+	setLeds()
 	r := getRegs()
 
 	r.Config[0].get(h)
@@ -252,6 +271,8 @@ func (h *I2cDev) LedFpReinit() error {
 	if err != nil {
 		return err
 	}
+	sysWritten, fanWritten = -1, -1
+	psuWritten = [maxPsu]string{psuShows, psuShows}
 	return nil
 }
 
@@ -260,20 +281,6 @@ func (h *I2cDev) LedStatus() error {
 	var o, c uint8
 	var d byte
 
-	if deviceVer == 0xff || deviceVer == 0x00 {
-		psuLed = []uint8{0x0c, 0x03}
-		psuLedYellow = []uint8{0x00, 0x00}
-		psuLedOff = []uint8{0x04, 0x01}
-		sysLed = 0xc0
-		sysLedGreen = 0x0
-		sysLedYellow = 0xc
-		sysLedOff = 0x80
-		fanLed = 0x30
-		fanLedGreen = 0x10
-		fanLedYellow = 0x20
-		fanLedOff = 0x30
-	}
-
 	allFanGood := true
 	fanStatChange := false
 	for j := 0; j < maxFanTrays; j++ {
@@ -285,47 +292,28 @@ func (h *I2cDev) LedStatus() error {
 			fanStatChange = true
 			//if any fan tray is failed or not installed, set front panel FAN led to yellow
 			if strings.Contains(p, "warning") && !strings.Contains(lastFanStatus[j], "not installed") {
-				r.Output[0].get(h)
-				err := DoI2cRpc()
-				if err != nil {
-					return err
-				}
-				o = s[0].D[0]
-				d = 0xff ^ fanLed
-				o &= d
-				o |= fanLedYellow
-				r.Output[0].set(h, o)
-				err = DoI2cRpc()
-				if err != nil {
-					return err
-				}
-				log.Print("warning: fan tray ", j+1, " failure")
+				fanLedState.Set(Fault, Steady(Yellow))
+				eventlog.Record(eventlog.Warning, "ledgpiod",
+					"fan_tray."+strconv.Itoa(j+1)+".status",
+					lastFanStatus[j], p, "fan tray %d failure", j+1)
 				if !forceFanSpeed {
 					redis.Hset(redis.DefaultHash, "fan_tray.speed", "max")
 					forceFanSpeed = true
 				}
 			} else if strings.Contains(p, "not installed") {
-				r.Output[0].get(h)
-				err := DoI2cRpc()
-				if err != nil {
-					return err
-				}
-				o = s[0].D[0]
-				d = 0xff ^ fanLed
-				o &= d
-				o |= fanLedYellow
-				r.Output[0].set(h, o)
-				err = DoI2cRpc()
-				if err != nil {
-					return err
-				}
-				log.Print("warning: fan tray ", j+1, " not installed")
+				fanLedState.Set(Fault, Steady(Yellow))
+				eventlog.Record(eventlog.Warning, "ledgpiod",
+					"fan_tray."+strconv.Itoa(j+1)+".status",
+					lastFanStatus[j], p, "fan tray %d not installed",
+					j+1)
 				if !forceFanSpeed {
 					redis.Hset(redis.DefaultHash, "fan_tray.speed", "max")
 					forceFanSpeed = true
 				}
 			} else if strings.Contains(lastFanStatus[j], "not installed") && (strings.Contains(p, "warning") || strings.Contains(p, "ok")) {
-				log.Print("notice: fan tray ", j+1, " installed")
+				eventlog.Record(eventlog.Notice, "ledgpiod",
+					"fan_tray."+strconv.Itoa(j+1)+".status",
+					lastFanStatus[j], p, "fan tray %d installed", j+1)
 			}
 		}
 		lastFanStatus[j] = p
@@ -342,20 +330,8 @@ func (h *I2cDev) LedStatus() error {
 				}
 			}
 			if allStat {
-				r.Output[0].get(h)
-				err := DoI2cRpc()
-				if err != nil {
-					return err
-				}
-				o = s[0].D[0]
-				d = 0xff ^ fanLed
-				o &= d
-				o |= fanLedGreen
-				r.Output[0].set(h, o)
-				err = DoI2cRpc()
-				if err != nil {
-					return err
-				}
+				fanLedState.Clear(Fault)
+				fanLedState.Set(Status, Steady(Green))
 				log.Print("notice: all fan trays up")
 				redis.Hset(redis.DefaultHash, "fan_tray.speed.return", "")
 				forceFanSpeed = false
@@ -364,9 +340,10 @@ func (h *I2cDev) LedStatus() error {
 
 	}
 
+	red, _ := redis.Hget(redis.DefaultHash, "power.redundancy")
 	for j := 0; j < maxPsu; j++ {
 		p, _ := redis.Hget(redis.DefaultHash, "psu"+strconv.Itoa(j+1)+".status")
-		if lastPsuStatus[j] != p {
+		if lastPsuStatus[j] != p || lastRedundancy != red || psuRewrite {
 			r.Output[0].get(h)
 			r.Config[0].get(h)
 			err := DoI2cRpc()
@@ -375,15 +352,20 @@ func (h *I2cDev) LedStatus() error {
 			}
 			o = s[0].D[0]
 			c = s[1].D[0]
+			//with degraded redundancy, the missing PSU led is yellow too
+			missing := strings.Contains(p, "not_installed") &&
+				red == "degraded"
 			//if PSU is not installed or installed and powered on, set front panel PSU led to off or green (PSU drives)
-			if strings.Contains(p, "not_installed") || strings.Contains(p, "powered_on") {
+			if (strings.Contains(p, "not_installed") && !missing) || strings.Contains(p, "powered_on") {
 				c |= psuLed[j]
-			} else if strings.Contains(p, "powered_off") {
+				psuWritten[j] = psuShows
+			} else if strings.Contains(p, "powered_off") || missing {
 				//if PSU is installed but powered off, set front panel PSU led to yellow
 				d = 0xff ^ psuLed[j]
 				o &= d
 				o |= psuLedYellow[j]
 				c &= (psuLed[j]) ^ 0xff
+				psuWritten[j] = Yellow.String()
 			}
 			r.Output[0].set(h, o)
 			r.Config[0].set(h, c)
@@ -392,12 +374,20 @@ func (h *I2cDev) LedStatus() error {
 				return err
 			}
 
-			lastPsuStatus[j] = p
-			if p != "" {
-				log.Print("notice: psu", j+1, " ", p)
+			if p != "" && p != lastPsuStatus[j] {
+				sev := eventlog.Notice
+				if strings.Contains(p, "powered_off") {
+					sev = eventlog.Warning
+				}
+				eventlog.Record(sev, "ledgpiod",
+					"psu"+strconv.Itoa(j+1)+".status",
+					lastPsuStatus[j], p, "psu%d %s", j+1, p)
 			}
+			lastPsuStatus[j] = p
 		}
 	}
+	lastRedundancy = red
+	psuRewrite = false
 	return nil
 }
 
@@ -449,7 +439,9 @@ func (h *I2cDev) CheckSystemFans() string {
 		systemFanDirection = "mixed"
 		p, _ := redis.Hget(redis.DefaultHash, "system.fan_direction")
 		if !strings.Contains(p, "mixed") {
-			log.Print("warning: mismatching fan direction detected, check fan trays and PSUs")
+			eventlog.Record(eventlog.Warning, "ledgpiod",
+				"system.fan_direction", p, "mixed",
+				"mismatching fan direction detected, check fan trays and PSUs")
 		}
 	} else {
 		if n != "" {
@@ -460,77 +452,14 @@ func (h *I2cDev) CheckSystemFans() string {
 	return systemFanDirection
 }
 
-func writeRegs() error {
-	for k, v := range WrRegVal {
-		switch WrRegFn[k] {
-		case "speed":
-			if false {
-				log.Print("test", k, v)
-			}
-		}
-		delete(WrRegVal, k)
-	}
-	return nil
-}
-
 func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
-	_, p := WrRegFn[args.Field]
-	if !p {
-		return fmt.Errorf("cannot hset: %s", args.Field)
-	}
-	_, q := WrRegRng[args.Field]
-	if !q {
-		err := i.set(args.Field, string(args.Value), false)
-		if err == nil {
-			*reply = 1
-			WrRegVal[args.Field] = string(args.Value)
-		}
-		return err
-	}
-	var a [2]int
-	var e [2]error
-	if len(WrRegRng[args.Field]) == 2 {
-		for i, v := range WrRegRng[args.Field] {
-			a[i], e[i] = strconv.Atoi(v)
-		}
-		if e[0] == nil && e[1] == nil {
-			val, err := strconv.Atoi(string(args.Value))
-			if err != nil {
-				return err
-			}
-			if val >= a[0] && val <= a[1] {
-				err := i.set(args.Field,
-					string(args.Value), false)
-				if err == nil {
-					*reply = 1
-					WrRegVal[args.Field] =
-						string(args.Value)
-				}
-				return err
-			}
-			return fmt.Errorf("Cannot hset.  Valid range is: %s",
-				WrRegRng[args.Field])
-		}
-	}
-	for _, v := range WrRegRng[args.Field] {
-		if v == string(args.Value) {
-			err := i.set(args.Field, string(args.Value), false)
-			if err == nil {
-				*reply = 1
-				WrRegVal[args.Field] = string(args.Value)
-			}
-			return err
-		}
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
 	}
-	return fmt.Errorf("Cannot hset.  Valid values are: %s",
-		WrRegRng[args.Field])
-}
-
-func (i *Info) set(key, value string, isReadyEvent bool) error {
-	i.pub.Print(key, ": ", value)
-	return nil
+	return err
 }
 
 func (i *Info) publish(key string, value interface{}) {
-	i.pub.Print(key, ": ", value)
+	i.d.Publish(key, value)
 }
@@ -0,0 +1,184 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ledgpiod
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+)
+
+// Color of a front panel LED. In a pattern, Base is the color that the
+// next lower priority request shows at the time.
+type Color int
+
+const (
+	Off Color = iota
+	Green
+	Yellow
+	Base
+)
+
+func (c Color) String() string {
+	switch c {
+	case Off:
+		return "off"
+	case Green:
+		return "green"
+	case Yellow:
+		return "yellow"
+	case Base:
+		return "base"
+	}
+	return strconv.Itoa(int(c))
+}
+
+// Tick is the step of the patterns.
+const Tick = 250 * time.Millisecond
+
+// Pattern is a sequence of colors, one per Tick, that repeats.
+type Pattern []Color
+
+func Steady(c Color) Pattern { return Pattern{c} }
+
+// Blink alternates c with off, each for n ticks.
+func Blink(c Color, n int) Pattern {
+	p := make(Pattern, 2*n)
+	for i := 0; i < n; i++ {
+		p[i] = c
+	}
+	return p
+}
+
+// Beacon blinks whatever the LED would otherwise show at 1Hz, so that a
+// fault stays visible while identifying.
+var Beacon = Pattern{Base, Base, Off, Off}
+
+// Priority of a request of an LED; the highest shows.
+type Priority int
+
+const (
+	Status Priority = iota
+	Fault
+	Identify
+	nPriority
+)
+
+// Led arbitrates the patterns requested of an LED.
+type Led struct {
+	requests [nPriority]Pattern
+}
+
+func (l *Led) Set(p Priority, pat Pattern) { l.requests[p] = pat }
+
+func (l *Led) Clear(p Priority) { l.requests[p] = nil }
+
+// At returns the color of the LED at tick t.
+func (l *Led) At(t int) Color {
+	return l.at(nPriority-1, t)
+}
+
+func (l *Led) at(p Priority, t int) Color {
+	for ; p >= 0; p-- {
+		pat := l.requests[p]
+		if len(pat) == 0 {
+			continue
+		}
+		if c := pat[t%len(pat)]; c != Base {
+			return c
+		}
+		return l.at(p-1, t)
+	}
+	return Off
+}
+
+var (
+	sysLedState, fanLedState Led
+
+	// the colors last written, -1 if unknown
+	sysWritten, fanWritten Color = -1, -1
+
+	tick          int
+	identifyUntil time.Time
+)
+
+// bits returns the output bits for c of an LED.
+func bits(c Color, mask, green, yellow, off byte) byte {
+	switch c {
+	case Green:
+		return green & mask
+	case Yellow:
+		return yellow & mask
+	}
+	return off & mask
+}
+
+// blink writes the colors of the system and fan LEDs at each Tick, if
+// they've changed, and ends identify when due.
+func (c *Command) blink() error {
+	if readStopped() == 1 || first == 1 {
+		return nil
+	}
+	if !identifyUntil.IsZero() && time.Now().After(identifyUntil) {
+		c.identify("false")
+		c.d.Publish("system.identify", "false")
+	}
+	tick++
+	sys, fan := sysLedState.At(tick), fanLedState.At(tick)
+	if sys == sysWritten && fan == fanWritten {
+		return nil
+	}
+	h := &Vdev
+	r := getRegs()
+	r.Output[0].get(h)
+	if err := DoI2cRpc(); err != nil {
+		return err
+	}
+	o := s[0].D[0]
+	o &^= sysLed | fanLed
+	o |= bits(sys, sysLed, sysLedGreen, sysLedYellow, sysLedOff)
+	o |= bits(fan, fanLed, fanLedGreen, fanLedYellow, fanLedOff)
+	r.Output[0].set(h, o)
+	if err := DoI2cRpc(); err != nil {
+		return err
+	}
+	sysWritten, fanWritten = sys, fan
+	return c.readback()
+}
+
+// identify starts or stops the locate beacon: "true", "true SECONDS" or
+// "false".
+func (c *Command) identify(v string) error {
+	f := strings.Fields(v)
+	if len(f) == 0 || len(f) > 2 || f[0] == "false" && len(f) > 1 {
+		return fmt.Errorf("%q: want true [SECONDS] or false", v)
+	}
+	switch f[0] {
+	case "true":
+		identifyUntil = time.Time{}
+		if len(f) == 2 {
+			sec, err := strconv.ParseUint(f[1], 10, 32)
+			if err != nil || sec == 0 {
+				return fmt.Errorf("%s: invalid SECONDS", f[1])
+			}
+			identifyUntil = time.Now().
+				Add(time.Duration(sec) * time.Second)
+		}
+		sysLedState.Set(Identify, Beacon)
+		fanLedState.Set(Identify, Beacon)
+	case "false":
+		identifyUntil = time.Time{}
+		sysLedState.Clear(Identify)
+		fanLedState.Clear(Identify)
+	default:
+		return fmt.Errorf("%q: want true [SECONDS] or false", v)
+	}
+	eventlog.Record(eventlog.Notice, "ledgpiod", "system.identify", "", v,
+		"identify %s", v)
+	return nil
+}
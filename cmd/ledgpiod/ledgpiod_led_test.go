@@ -0,0 +1,61 @@
+package ledgpiod
+
+import "testing"
+
+func TestLed(t *testing.T) {
+	colors := func(l *Led, n int) []Color {
+		c := make([]Color, n)
+		for i := range c {
+			c[i] = l.At(i)
+		}
+		return c
+	}
+	var l Led
+	for i, x := range []struct {
+		set  func()
+		want []Color
+	}{
+		{func() {}, []Color{Off, Off, Off, Off}},
+		{func() { l.Set(Status, Steady(Green)) },
+			[]Color{Green, Green, Green, Green}},
+		{func() { l.Set(Identify, Beacon) },
+			[]Color{Green, Green, Off, Off}},
+		{func() { l.Set(Fault, Blink(Yellow, 1)) },
+			[]Color{Yellow, Off, Off, Off}},
+		{func() { l.Clear(Identify) },
+			[]Color{Yellow, Off, Yellow, Off}},
+		{func() { l.Clear(Fault) },
+			[]Color{Green, Green, Green, Green}},
+	} {
+		x.set()
+		got := colors(&l, len(x.want))
+		for j := range got {
+			if got[j] != x.want[j] {
+				t.Errorf("%d: got %v, want %v", i, got, x.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	// the fan LED of device versions 0 and 0xff, then later versions
+	for i, x := range []struct {
+		o, mask, green, yellow, off byte
+		want                        string
+	}{
+		{0x10, 0x30, 0x10, 0x20, 0x30, "green"},
+		{0x2f, 0x30, 0x10, 0x20, 0x30, "yellow"},
+		{0x30, 0x30, 0x10, 0x20, 0x30, "off"},
+		{0x00, 0x30, 0x10, 0x20, 0x30, "unknown"},
+		{0x02, 0x06, 0x02, 0x06, 0x00, "green"},
+		{0x06, 0x06, 0x02, 0x06, 0x00, "yellow"},
+		{0xf9, 0x06, 0x02, 0x06, 0x00, "off"},
+		{0x04, 0x06, 0x02, 0x06, 0x00, "unknown"},
+	} {
+		got := decode(x.o, x.mask, x.green, x.yellow, x.off)
+		if got != x.want {
+			t.Errorf("%d: got %s, want %s", i, got, x.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ledgpiod
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+)
+
+// psuShows is what a psu LED shows: "psu" when the supply drives it.
+const psuShows = "psu"
+
+var (
+	// what each psu LED was last set to show, "" if unknown
+	psuWritten [maxPsu]string
+	psuRewrite bool
+
+	ledAlarm bool
+)
+
+// decode returns the color of an LED from the expander's output bits.
+func decode(o, mask, green, yellow, off byte) string {
+	switch o & mask {
+	case green & mask:
+		return Green.String()
+	case off & mask:
+		return Off.String()
+	case yellow & mask:
+		return Yellow.String()
+	}
+	return "unknown"
+}
+
+// readback reads the expander after a write and publishes what each front
+// panel LED shows. If that isn't what was written, it raises led.alarm and
+// has the LEDs rewritten.
+func (c *Command) readback() error {
+	h := &Vdev
+	r := getRegs()
+	r.Output[0].get(h)
+	r.Config[0].get(h)
+	if err := DoI2cRpc(); err != nil {
+		return err
+	}
+	o, cfg := s[0].D[0], s[1].D[0]
+
+	var bad []string
+	show := func(k, v, want string) {
+		c.d.Changed(k, v)
+		if want != "" && v != want {
+			bad = append(bad, k+" "+v+" not "+want)
+		}
+	}
+	want := func(col Color) string {
+		if col < 0 {
+			return ""
+		}
+		return col.String()
+	}
+	show("led.system",
+		decode(o, sysLed, sysLedGreen, sysLedYellow, sysLedOff),
+		want(sysWritten))
+	show("led.fan",
+		decode(o, fanLed, fanLedGreen, fanLedYellow, fanLedOff),
+		want(fanWritten))
+	for j := 0; j < maxPsu; j++ {
+		v := psuShows
+		if cfg&psuLed[j] == 0 {
+			v = "unknown"
+			switch o & psuLed[j] {
+			case psuLedYellow[j] & psuLed[j]:
+				v = Yellow.String()
+			case psuLedOff[j] & psuLed[j]:
+				v = Off.String()
+			}
+		}
+		show("led.psu"+strconv.Itoa(j+1), v, psuWritten[j])
+	}
+
+	if len(bad) > 0 {
+		sysWritten, fanWritten = -1, -1
+		psuRewrite = true
+		if !ledAlarm {
+			eventlog.Record(eventlog.Warning, "ledgpiod", "led.alarm",
+				"false", "true", "front panel LED mismatch: %s",
+				strings.Join(bad, ", "))
+		}
+	} else if ledAlarm {
+		eventlog.Record(eventlog.Notice, "ledgpiod", "led.alarm",
+			"true", "false", "front panel LEDs match")
+	}
+	ledAlarm = len(bad) > 0
+	c.d.Changed("led.alarm", strconv.FormatBool(ledAlarm))
+	return nil
+}
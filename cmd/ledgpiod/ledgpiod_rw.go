@@ -6,15 +6,14 @@
 package ledgpiod
 
 import (
-	"net/rpc"
-	"time"
+	"errors"
 	"unsafe"
 
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
 	"github.com/platinasystems/i2c"
-	"github.com/platinasystems/log"
 )
 
-const MAXOPS = 30
+const MAXOPS = daemon.MAXOPS
 
 type I struct {
 	InUse     bool
@@ -31,8 +30,6 @@ type R struct {
 	E error
 }
 
-type I2cReq int
-
 var b = [i2c.BlockMax]byte{0}
 var i = I{false, i2c.RW(0), 0, 0, b, 0, 0, 0}
 var j [MAXOPS]I
@@ -40,13 +37,13 @@ var r = R{b, nil}
 var s [MAXOPS]R
 var x int
 
+// dev is the device of the queued operations
+var dev *I2cDev
+
 var dummy byte
 var regsPointer = unsafe.Pointer(&dummy)
 var regsAddr = uintptr(unsafe.Pointer(&dummy))
 
-var clientA *rpc.Client
-var dialed int = 0
-
 // offset function has divide by two for 16-bit offset struct
 func getRegs() *regs {
 	clearJ()
@@ -60,6 +57,7 @@ func (r *reg8) get(h *I2cDev) {
 	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
 
 	j[x] = I{true, i2c.Read, r.offset(), i2c.ByteData, data, h.Bus, h.Addr, 0}
+	dev = h
 	x++
 }
 
@@ -67,6 +65,7 @@ func (r *reg16) get(h *I2cDev) {
 	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
 
 	j[x] = I{true, i2c.Read, r.offset(), i2c.WordData, data, h.Bus, h.Addr, 0}
+	dev = h
 	x++
 }
 
@@ -74,6 +73,7 @@ func (r *reg16r) get(h *I2cDev) {
 	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
 
 	j[x] = I{true, i2c.Read, r.offset(), i2c.WordData, data, h.Bus, h.Addr, 0}
+	dev = h
 	x++
 }
 
@@ -82,6 +82,7 @@ func (r *reg8) set(h *I2cDev, v uint8) {
 
 	data[0] = v
 	j[x] = I{true, i2c.Write, r.offset(), i2c.ByteData, data, h.Bus, h.Addr, 0}
+	dev = h
 	x++
 }
 
@@ -91,6 +92,7 @@ func (r *reg16) set(h *I2cDev, v uint16) {
 	data[0] = uint8(v >> 8)
 	data[1] = uint8(v)
 	j[x] = I{true, i2c.Write, r.offset(), i2c.WordData, data, h.Bus, h.Addr, 0}
+	dev = h
 	x++
 }
 
@@ -100,6 +102,7 @@ func (r *reg16r) set(h *I2cDev, v uint16) {
 	data[1] = uint8(v >> 8)
 	data[0] = uint8(v)
 	j[x] = I{true, i2c.Write, r.offset(), i2c.WordData, data, h.Bus, h.Addr, 0}
+	dev = h
 	x++
 }
 
@@ -111,29 +114,31 @@ func clearJ() {
 }
 
 func readStopped() byte {
-	var data = [i2c.BlockMax]byte{0, 0, 0, 0}
-	j[0] = I{true, i2c.Write, 0, i2c.ByteData, data, int(0x98), int(0), 0}
-	err := DoI2cRpc()
-	if err != nil {
+	if daemon.Stopped() {
 		return 1
 	}
-	return s[0].D[0]
+	return 0
 }
 
+// DoI2cRpc performs the queued operations, first selecting the mux channel
+// of their device if it's behind one.
 func DoI2cRpc() error {
-	if dialed == 0 {
-		client, err := rpc.DialHTTP("tcp", "127.0.0.1"+":1233")
-		if err != nil {
-			log.Print("dialing:", err)
-			return err
+	mux := dev != nil && dev.MuxAddr != 0
+	if mux {
+		if x >= MAXOPS {
+			return errors.New("no room to select mux")
 		}
-		clientA = client
-		dialed = 1
-		time.Sleep(time.Millisecond * time.Duration(50))
+		copy(j[1:], j[:x])
+		j[0] = I{true, i2c.Write, uint8(dev.MuxValue), i2c.Byte, b,
+			dev.MuxBus, dev.MuxAddr, 0}
+		x++
+	}
+	err := daemon.I2cRpc(&j, &s)
+	if mux {
+		copy(s[:], s[1:])
 	}
-	err := clientA.Call("I2cReq.ReadWrite", &j, &s)
+	dev = nil
 	if err != nil {
-		log.Print("i2cReq error:", err)
 		return err
 	}
 	clearJ()
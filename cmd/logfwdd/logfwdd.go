@@ -0,0 +1,424 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package logfwdd forwards the kernel and daemon logs to remote syslog
+// collectors.
+package logfwdd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes-bmc/cmd/mmclogd"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/log"
+)
+
+const (
+	ConfigFile       = "/etc/goes/logfwd.json"
+	SEQFILE          = "/tmp/logfwd.seq"
+	MAXQUEUE   int64 = 16 * 1024 * 1024
+)
+
+var (
+	QueueDir  = "/tmp/logfwd"
+	MMCQueue  = mmclogd.MMCDIR + "/logfwd"
+	retry     = 10 * time.Second
+	dialLimit = 5 * time.Second
+)
+
+// Collector is a remote syslog server. Transport is udp, tcp or tls;
+// Address is HOST[:PORT], the port defaulting to 514, or 6514 for tls.
+type Collector struct {
+	Address   string
+	Transport string `json:",omitempty"`
+	CA        string `json:",omitempty"`
+	Insecure  bool   `json:",omitempty"`
+}
+
+type Config struct {
+	Collectors []Collector
+}
+
+type Command struct {
+	Info
+	Init func()
+	init sync.Once
+}
+
+type Info struct {
+	mutex   sync.Mutex
+	host    string
+	bootId  string
+	seq_end uint64
+	started bool
+	stopped bool
+	senders []*sender
+
+	// followed is closed when follow returns
+	followed chan struct{}
+}
+
+func (*Command) String() string { return "logfwdd" }
+
+func (*Command) Usage() string { return "logfwdd" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "remote syslog forwarding daemon",
+	}
+}
+
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	logfwdd follows /dev/kmsg and sends each kernel and daemon message
+	as RFC 5424 syslog to the collectors configured in
+	` + ConfigFile + `, e.g.
+
+	{"Collectors": [
+		{"Address": "192.168.101.2", "Transport": "udp"},
+		{"Address": "logs.example.com", "Transport": "tls",
+		 "CA": "/etc/goes/logs-ca.pem"}
+	]}
+
+	The APP-NAME is the daemon that logged the message, or kernel.
+	TCP and TLS use octet counting framing.
+
+	Messages for an unreachable collector are queued in
+	` + QueueDir + `, and moved to ` + MMCQueue + ` once mmclogd
+	mounts the MMC card, until the collector is reachable again.`,
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(...string) error {
+	if c.Init != nil {
+		c.init.Do(c.Init)
+	}
+
+	conf, err := LoadConfig(ConfigFile)
+	if os.IsNotExist(err) || (err == nil && len(conf.Collectors) == 0) {
+		// nothing to forward
+		<-goes.Stop
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.host, _ = os.Hostname()
+	if err = os.MkdirAll(QueueDir, 0755); err != nil {
+		return err
+	}
+	for i, col := range conf.Collectors {
+		s, err := newSender(col, queueFile(QueueDir, i))
+		if err != nil {
+			return err
+		}
+		c.senders = append(c.senders, s)
+		go s.run()
+	}
+	c.loadSeq()
+	onMMC := false
+
+	k, err := os.Open(log.DevKmsg)
+	if err != nil {
+		return err
+	}
+	c.followed = make(chan struct{})
+	go c.follow(k)
+
+	t := time.NewTicker(15 * time.Second)
+	for {
+		select {
+		case <-goes.Stop:
+			c.stop(k)
+			return c.saveSeq()
+		case <-t.C:
+			if err = c.saveSeq(); err != nil {
+				log.Print("logfwdd: ", err)
+			}
+			if !onMMC {
+				onMMC, err = c.moveQueues()
+				if err != nil {
+					log.Print("logfwdd: ", err)
+				}
+			}
+		}
+	}
+}
+
+func queueFile(dir string, i int) string {
+	return dir + "/" + strconv.Itoa(i) + ".queue"
+}
+
+// moveQueues moves the queues to the MMC card, so that they survive a
+// reboot, once mmclogd has mounted it.
+func (c *Info) moveQueues() (bool, error) {
+	if _, err := os.Stat(mmclogd.ENABLE); err != nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(MMCQueue, 0755); err != nil {
+		return false, err
+	}
+	for i, s := range c.senders {
+		if err := s.q.Move(queueFile(MMCQueue, i)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func LoadConfig(fn string) (*Config, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{}
+	if err = json.Unmarshal(b, conf); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	for _, col := range conf.Collectors {
+		switch col.Transport {
+		case "", "udp", "tcp", "tls":
+		default:
+			return nil, fmt.Errorf("%s: %s: unknown transport",
+				fn, col.Transport)
+		}
+	}
+	return conf, nil
+}
+
+// follow reads kmsg records until the device is closed or stop.
+func (c *Info) follow(k *os.File) {
+	defer close(c.followed)
+	var kmsg log.Kmsg
+	var si syscall.Sysinfo_t
+	buf := make([]byte, mmclogd.MAXLEN)
+	for {
+		n, err := k.Read(buf)
+		if errors.Is(err, syscall.EPIPE) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		kmsg.Parse(buf[:n])
+		syscall.Sysinfo(&si)
+		t := kmsg.Stamp.Time(time.Now(), int64(si.Uptime))
+		msg := Format(&kmsg, t, c.host)
+
+		// the senders are stopped with the mutex held, so hold it
+		// through the sends too
+		c.mutex.Lock()
+		if c.stopped {
+			c.mutex.Unlock()
+			return
+		}
+		if c.started && uint64(kmsg.Seq) <= c.seq_end {
+			c.mutex.Unlock()
+			continue
+		}
+		c.started = true
+		c.seq_end = uint64(kmsg.Seq)
+		for _, s := range c.senders {
+			s.send(msg)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// stop ends follow, then each sender, which queues what it hasn't sent.
+func (c *Info) stop(k *os.File) {
+	c.mutex.Lock()
+	c.stopped = true
+	c.mutex.Unlock()
+	k.Close()
+	select {
+	case <-c.followed:
+	case <-time.After(time.Second):
+		// still blocked in read, but it won't send again
+	}
+	for _, s := range c.senders {
+		s.stop()
+	}
+}
+
+func (c *Info) loadSeq() {
+	b, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return
+	}
+	c.bootId = strings.TrimSpace(string(b))
+	b, err = ioutil.ReadFile(SEQFILE)
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 || fields[0] != c.bootId {
+		return
+	}
+	if u, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+		c.seq_end = u
+		c.started = true
+	}
+}
+
+func (c *Info) saveSeq() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.started {
+		return nil
+	}
+	s := fmt.Sprint(c.bootId, " ", c.seq_end, "\n")
+	return ioutil.WriteFile(SEQFILE, []byte(s), 0644)
+}
+
+type sender struct {
+	network string
+	address string
+	tls     *tls.Config
+	conn    net.Conn
+	q       *Queue
+	ch      chan string
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+func newSender(col Collector, queue string) (*sender, error) {
+	s := &sender{
+		network: col.Transport,
+		address: col.Address,
+		q:       NewQueue(queue, MAXQUEUE),
+		ch:      make(chan string, 256),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	port := "514"
+	switch s.network {
+	case "":
+		s.network = "udp"
+	case "tls":
+		port = "6514"
+		host := s.address
+		if h, _, err := net.SplitHostPort(s.address); err == nil {
+			host = h
+		}
+		s.tls = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: col.Insecure,
+		}
+		if col.CA != "" {
+			pem, err := ioutil.ReadFile(col.CA)
+			if err != nil {
+				return nil, err
+			}
+			s.tls.RootCAs = x509.NewCertPool()
+			if !s.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s: no certificates", col.CA)
+			}
+		}
+	}
+	if _, _, err := net.SplitHostPort(s.address); err != nil {
+		s.address = net.JoinHostPort(s.address, port)
+	}
+	return s, nil
+}
+
+// send hands a message to the sender, queueing it on disk rather than
+// holding up the kmsg follower.
+func (s *sender) send(msg string) {
+	select {
+	case s.ch <- msg:
+	default:
+		s.q.Put(msg)
+	}
+}
+
+// stop ends run and waits for it to queue the messages still in ch. There
+// must be no send after stop.
+func (s *sender) stop() {
+	close(s.quit)
+	<-s.done
+	close(s.ch)
+}
+
+func (s *sender) run() {
+	t := time.NewTicker(retry)
+	defer t.Stop()
+	defer close(s.done)
+	s.connect()
+	for {
+		select {
+		case <-s.quit:
+			for len(s.ch) > 0 {
+				s.q.Put(<-s.ch)
+			}
+			if s.conn != nil {
+				s.conn.Close()
+			}
+			return
+		case msg := <-s.ch:
+			if s.conn == nil || !s.q.Empty() {
+				s.q.Put(msg)
+				continue
+			}
+			if err := s.write(msg); err != nil {
+				s.q.Put(msg)
+			}
+		case <-t.C:
+			if s.conn == nil {
+				s.connect()
+			}
+			if s.conn != nil && !s.q.Empty() {
+				s.q.Drain(s.write)
+			}
+		}
+	}
+}
+
+func (s *sender) connect() {
+	var err error
+	d := &net.Dialer{Timeout: dialLimit}
+	if s.tls != nil {
+		s.conn, err = tls.DialWithDialer(d, "tcp", s.address, s.tls)
+	} else {
+		s.conn, err = d.Dial(s.network, s.address)
+	}
+	if err != nil {
+		s.conn = nil
+	}
+}
+
+func (s *sender) write(msg string) error {
+	if s.conn == nil {
+		return fmt.Errorf("%s: not connected", s.address)
+	}
+	b := []byte(msg)
+	if s.network != "udp" {
+		b = Frame(msg)
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(dialLimit))
+	if _, err := s.conn.Write(b); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
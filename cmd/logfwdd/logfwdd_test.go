@@ -0,0 +1,201 @@
+package logfwdd
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/log"
+)
+
+func TestFormat(t *testing.T) {
+	var k log.Kmsg
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+	k.Parse([]byte("28,100,5000,-;goes.ledgpiod[321]: warning: fan tray 1 failure"))
+	s := Format(&k, tm, "bmc1")
+	want := "<28>1 2020-01-02T03:04:05.000006Z bmc1 ledgpiod 321 - - warning: fan tray 1 failure"
+	if s != want {
+		t.Fatalf("got %q\nwant %q", s, want)
+	}
+
+	k.Parse([]byte("6,101,5001,-;eth0: link up"))
+	s = Format(&k, tm, "")
+	want = "<6>1 2020-01-02T03:04:05.000006Z - kernel - - - eth0: link up"
+	if s != want {
+		t.Fatalf("got %q\nwant %q", s, want)
+	}
+
+	if b := Frame("hello"); string(b) != "5 hello" {
+		t.Fatalf("frame %q", b)
+	}
+}
+
+func TestUdp(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	dir, err := ioutil.TempDir("", "logfwdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newSender(Collector{Address: pc.LocalAddr().String()},
+		filepath.Join(dir, "0.queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.run()
+	defer s.stop()
+	s.send("<6>1 - - kernel - - - hello")
+
+	buf := make([]byte, 512)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "<6>1 - - kernel - - - hello" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// Messages sent while the collector is down are queued, then delivered in
+// order once it is listening.
+func TestTcpQueue(t *testing.T) {
+	retry = 50 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir, err := ioutil.TempDir("", "logfwdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newSender(Collector{Address: addr, Transport: "tcp"},
+		filepath.Join(dir, "0.queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.run()
+	defer s.stop()
+	for i := 0; i < 3; i++ {
+		s.send("msg " + strconv.Itoa(i))
+	}
+	time.Sleep(2 * retry)
+	if s.q.Empty() {
+		t.Fatal("nothing queued")
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("address reused: ", err)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for i := 0; i < 3; i++ {
+		l, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(l))
+		b := make([]byte, n)
+		if _, err = io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		if want := "msg " + strconv.Itoa(i); string(b) != want {
+			t.Fatalf("got %q, want %q", b, want)
+		}
+	}
+}
+
+// Messages not yet sent when the sender stops are queued, not lost.
+func TestStop(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir, err := ioutil.TempDir("", "logfwdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "0.queue")
+	s, err := newSender(Collector{Address: addr, Transport: "tcp"}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.run()
+	for i := 0; i < 3; i++ {
+		s.send("msg " + strconv.Itoa(i))
+	}
+	s.stop()
+
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "msg 0\nmsg 1\nmsg 2\n"; string(b) != want {
+		t.Fatalf("got %q, want %q", b, want)
+	}
+}
+
+// Moving a queue keeps what was already queued at the new place first.
+func TestQueueMove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfwdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from := filepath.Join(dir, "tmp.queue")
+	to := filepath.Join(dir, "mmc.queue")
+	if err = ioutil.WriteFile(to, []byte("msg 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := NewQueue(from, 12)
+	for i := 1; i < 4; i++ {
+		q.Put("msg " + strconv.Itoa(i))
+	}
+	if err = q.Move(to); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	q.Drain(func(msg string) error {
+		got = append(got, msg)
+		return nil
+	})
+	if s := strings.Join(got, ","); s != "msg 0,msg 1,msg 2,msg 3" {
+		t.Fatalf("got %q", s)
+	}
+	if _, err = os.Stat(from); !os.IsNotExist(err) {
+		t.Fatal(from, " not removed")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package logfwdd
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// Queue holds messages on disk while a collector is unreachable. When it
+// exceeds its size, the oldest half is dropped.
+type Queue struct {
+	mutex sync.Mutex
+	fn    string
+	max   int64
+}
+
+func NewQueue(fn string, max int64) *Queue {
+	return &Queue{fn: fn, max: max}
+}
+
+func (q *Queue) Put(msg string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	mode := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	f, err := os.OpenFile(q.fn, mode, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(msg + "\n")
+	fi, serr := f.Stat()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if serr == nil && fi.Size() > q.max/2 {
+		return os.Rename(q.fn, q.fn+".old")
+	}
+	return nil
+}
+
+// Move moves the queue to fn, after anything already queued there, as
+// left from before a reboot.
+func (q *Queue) Move(fn string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if fn == q.fn {
+		return nil
+	}
+	mode := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	w, err := os.OpenFile(fn, mode, 0644)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	for _, old := range []string{q.fn + ".old", q.fn} {
+		f, err := os.Open(old)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(old); err != nil {
+			return err
+		}
+	}
+	q.fn = fn
+	return nil
+}
+
+// Empty reports whether nothing is queued.
+func (q *Queue) Empty() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, fn := range []string{q.fn + ".old", q.fn} {
+		if fi, err := os.Stat(fn); err == nil && fi.Size() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Drain sends the queued messages, oldest first, and removes them once
+// sent. On error, the unsent messages remain queued.
+func (q *Queue) Drain(send func(string) error) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, fn := range []string{q.fn + ".old", q.fn} {
+		f, err := os.Open(fn)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		var rest []string
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			if err == nil {
+				if err = send(scan.Text()); err == nil {
+					continue
+				}
+			}
+			rest = append(rest, scan.Text())
+		}
+		f.Close()
+		if err != nil {
+			return q.rewrite(fn, rest, err)
+		}
+		if err = os.Remove(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Queue) rewrite(fn string, rest []string, err error) error {
+	w, werr := os.Create(fn + ".tmp")
+	if werr != nil {
+		return werr
+	}
+	bw := bufio.NewWriter(w)
+	for _, s := range rest {
+		bw.WriteString(s + "\n")
+	}
+	bw.Flush()
+	w.Close()
+	if werr = os.Rename(w.Name(), fn); werr != nil {
+		return werr
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package logfwdd
+
+import (
+	"fmt"
+	"log/syslog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/log"
+)
+
+// goes daemons log as PROG[PID]: MSG, where PROG may be goes.DAEMON
+var idRe = regexp.MustCompile(`^([A-Za-z0-9_.-]+)\[([0-9]+)\]: ?(.*)$`)
+
+// Format returns a kmsg record as an RFC 5424 message. The APP-NAME is the
+// logging daemon, or "kernel" for kernel messages.
+func Format(k *log.Kmsg, t time.Time, host string) string {
+	app, procid, msg := "kernel", "-", k.Msg
+	if k.Pri&log.FacilityMask != syslog.LOG_KERN {
+		app = "-"
+		if m := idRe.FindStringSubmatch(k.Msg); m != nil {
+			app = m[1]
+			if i := strings.LastIndex(app, "."); i >= 0 {
+				app = app[i+1:]
+			}
+			procid, msg = m[2], m[3]
+		}
+	}
+	if host == "" {
+		host = "-"
+	}
+	return fmt.Sprint("<", int(k.Pri), ">1 ",
+		t.UTC().Format("2006-01-02T15:04:05.000000Z"), " ",
+		host, " ", app, " ", procid, " - - ", msg)
+}
+
+// Frame prefixes a message with its length, the octet counting framing of
+// RFC 6587 and RFC 5425, for stream transports.
+func Frame(msg string) []byte {
+	return []byte(strconv.Itoa(len(msg)) + " " + msg)
+}
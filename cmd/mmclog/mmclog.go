@@ -5,28 +5,34 @@
 package mmclog
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/flags"
+	"github.com/platinasystems/goes-bmc/cmd/mmclogd"
+	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/parms"
 )
 
 const (
 	LOGA      = "/mnt/dmesg.txt"
 	LOGB      = "/mnt/dmesg2.txt"
-	DfltByte  = "0"
-	DfltCount = "25"
-	linesize  = 160
+	DfltCount = 25
 )
 
 type Command struct{}
 
 func (Command) String() string { return "mmclog" }
 
-func (Command) Usage() string { return "mmclog [-b BYTE] [-c COUNT] -2" }
+func (Command) Usage() string {
+	return `mmclog [-b BYTE] [-c COUNT] [-2 | -g N | -l] [-since TIME]
+	[-until TIME] [-grep REGEX] [-seq N] [-f] [-json]`
+}
 
 func (Command) Apropos() lang.Alt {
 	return lang.Alt{
@@ -43,114 +49,207 @@ DESCRIPTION
 	The -b parameter specifies starting byte number.
 	The -c parameter specifies number of lines to display.
 	The -2 flag displays the secondary(older) dmesg log, if available.
+	The -g parameter selects an older generation, 1 being the primary
+	log; compressed generations are read transparently.
+	The -l flag lists the available generations.
+
+	The default is to display the last 25 lines of the primary log.
+
+	The -since and -until parameters select messages logged between
+	the given times, either "YYYY-MM-DD HH:MM:SS", RFC 3339, a date,
+	or a duration before now such as 1h.
+	The -grep parameter selects lines matching a regular expression.
+	The -seq parameter starts at the given kmsg sequence number.
+	These search all generations, oldest first, unless one is given
+	with -2 or -g, and display every match unless limited with -c.
 
-	The default is to display the last 25 lines of the primary log.`,
+	The -f flag follows the primary log as it grows.
+	The -json flag prints one JSON object per message.
+
+EXAMPLES
+	mmclog -since 2h -grep "fan tray"
+	mmclog -seq 1200 -c 50
+	mmclog -f -grep warning`,
 	}
 }
 
-func (Command) Main(args ...string) (err error) {
-	flag, args := flags.New(args, "-2")
-	parm, args := parms.New(args, "-b", "-c")
-	if len(parm.ByName["-b"]) == 0 {
-		parm.ByName["-b"] = DfltByte
+type display struct {
+	json  bool
+	count int
+	n     int
+	file  string
+}
+
+func (d *display) print(r *Record) bool {
+	if d.count > 0 && d.n >= d.count {
+		return false
 	}
-	if len(parm.ByName["-c"]) == 0 {
-		parm.ByName["-c"] = DfltCount
+	d.n++
+	if d.json {
+		b, err := json.Marshal(r)
+		if err == nil {
+			fmt.Println(string(b))
+		}
+		return true
 	}
-	log := LOGA
-	if flag.ByName["-2"] {
-		log = LOGB
+	if r.File != d.file {
+		d.file = r.File
+		if err := dspSiz(r.File); err != nil {
+			fmt.Println(err)
+		}
 	}
-	if _, err := os.Stat(log); os.IsNotExist(err) {
-		fmt.Println("log file: ", log, "does not exist")
-		return nil
+	fmt.Print("byte=", r.Byte, " seq#=", r.line, "\n")
+	return true
+}
+
+func (Command) Main(args ...string) (err error) {
+	flag, args := flags.New(args, "-2", "-l", "-f", "-json")
+	parm, args := parms.New(args, "-b", "-c", "-g", "-since", "-until",
+		"-grep", "-seq")
+	if len(args) > 0 {
+		return fmt.Errorf("%v: unexpected", args)
 	}
-	if err = dspSiz(log); err != nil {
-		return err
+	if flag.ByName["-l"] {
+		for _, fn := range mmclogd.Generations(mmclogd.MMCDIR) {
+			if err = dspSiz(fn); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	displ, err := strconv.Atoi(parm.ByName["-b"])
-	if err != nil {
-		return err
+	var f filter
+	if s := parm.ByName["-since"]; s != "" {
+		if f.since, err = parseTime(s); err != nil {
+			return err
+		}
 	}
-	count, err := strconv.Atoi(parm.ByName["-c"])
-	if err != nil {
-		return err
+	if s := parm.ByName["-until"]; s != "" {
+		if f.until, err = parseTime(s); err != nil {
+			return err
+		}
 	}
-	tail := false
-	if displ == 0 {
-		tail = true
+	if s := parm.ByName["-grep"]; s != "" {
+		if f.re, err = regexp.Compile(s); err != nil {
+			return err
+		}
 	}
-	if err = dspLog(log, displ, count, tail); err != nil {
-		return err
+	if s := parm.ByName["-seq"]; s != "" {
+		if f.seq, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return fmt.Errorf("%s: invalid sequence number", s)
+		}
 	}
-	return nil
-}
-
-func dspLog(log string, displ int, count int, tail bool) (err error) {
-	nomsize := count * linesize
-	f, err := os.Open(log)
-	if err != nil {
-		return err
+	d := &display{json: flag.ByName["-json"]}
+	if s := parm.ByName["-c"]; s != "" {
+		if d.count, err = strconv.Atoi(s); err != nil || d.count < 1 {
+			return fmt.Errorf("%s: invalid count", s)
+		}
+	}
+	var start int64
+	if s := parm.ByName["-b"]; s != "" {
+		if start, err = strconv.ParseInt(s, 10, 64); err != nil ||
+			start < 0 {
+			return fmt.Errorf("%s: invalid byte", s)
+		}
 	}
-	defer f.Close()
 
-	if tail {
-		fi, err := f.Stat()
-		if err != nil {
-			panic(err)
+	logs := []string{LOGA}
+	if flag.ByName["-2"] {
+		logs = []string{LOGB}
+	} else if s := parm.ByName["-g"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s: invalid generation", s)
 		}
-		l := int(fi.Size()) - (count * linesize)
-		if l > 0 {
-			displ = l
-		} else {
-			displ = 0
+		log := mmclogd.GenName(mmclogd.MMCDIR, n)
+		if _, err := os.Stat(log + mmclogd.GZ); err == nil {
+			log += mmclogd.GZ
+		}
+		logs = []string{log}
+	} else if f.active() {
+		gens := mmclogd.Generations(mmclogd.MMCDIR)
+		logs = logs[:0]
+		for i := len(gens) - 1; i >= 0; i-- {
+			logs = append(logs, gens[i])
 		}
 	}
-
-	_, err = f.Seek(int64(displ), 0)
-	if err != nil {
-		panic(err)
+	follow := flag.ByName["-f"]
+	if follow && (len(logs) == 0 || logs[len(logs)-1] != LOGA) {
+		return fmt.Errorf("-f only follows the primary log")
 	}
-
-	buf := make([]byte, nomsize)
-	n, err := f.Read(buf)
-	if err != nil {
-		panic(err)
+	for _, log := range logs {
+		if _, err := os.Stat(log); os.IsNotExist(err) {
+			fmt.Println("log file: ", log, "does not exist")
+			return nil
+		}
 	}
 
-	i := 0
-	if tail {
-		c := 0
-		for j := len(buf) - 1; j > 0; j-- {
-			if string(buf[j]) == "\n" {
-				c++
-				if c == (count + 1) {
-					i = j + 1
+	if !f.active() && start == 0 {
+		// tail
+		count := d.count
+		if count == 0 {
+			count = DfltCount
+		}
+		if !strings.HasSuffix(logs[0], mmclogd.GZ) {
+			if start, err = tailOffset(logs[0], count); err != nil {
+				return err
+			}
+		} else {
+			var ring []*Record
+			_, err = scan(logs[0], 0, &f, func(r *Record) bool {
+				if ring = append(ring, r); len(ring) > count {
+					ring = ring[1:]
 				}
+				return true
+			})
+			for _, r := range ring {
+				d.print(r)
 			}
+			return err
 		}
+	} else if d.count == 0 && !f.active() {
+		d.count = DfltCount
 	}
 
-	l := 0
-	for j := i; j < n; j++ {
-		if string(buf[j]) == "\n" {
-			if i != 0 {
-				fmt.Print("byte=", displ+i, " seq#=")
-				for _, c := range buf[i:j] {
-					fmt.Printf("%c", c)
-				}
-				fmt.Println()
-			}
-			i = j + 1
-			l++
+	var off int64
+	for i, log := range logs {
+		if i > 0 {
+			start = 0
 		}
-		if !tail && l > count {
-			break
+		if off, err = scan(log, start, &f, d.print); err != nil {
+			return err
+		}
+	}
+	if !follow {
+		return nil
+	}
+	return followLog(off, &f, d)
+}
+
+// followLog prints new lines of the primary log, starting over when
+// mmclogd rotates it.
+func followLog(off int64, f *filter, d *display) error {
+	fi, err := os.Stat(LOGA)
+	if err != nil {
+		return err
+	}
+	d.count = 0
+	for {
+		time.Sleep(time.Second)
+		cur, err := os.Stat(LOGA)
+		if err != nil {
+			continue
+		}
+		if !os.SameFile(fi, cur) || cur.Size() < off {
+			fi, off = cur, 0
+		}
+		if cur.Size() == off {
+			continue
+		}
+		if off, err = scan(LOGA, off, f, d.print); err != nil {
+			return err
 		}
 	}
-	f.Close()
-	return nil
 }
 
 func dspSiz(log string) (err error) {
@@ -0,0 +1,76 @@
+package mmclog
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const testLog = `10 [2020-01-02 03:04:05] [0000012.000001] eth0: link up
+11 [2020-01-02 03:05:05] [0000072.000002] goes.ledgpiod[99]: warning: fan tray 1 failure
+11 [2020-01-02 03:06:05] [gap] 3 messages lost
+15 [2020-01-02 03:07:05] [0000192.000003] goes.ledgpiod[99]: notice: fan tray 1 installed
+`
+
+func TestScan(t *testing.T) {
+	f, err := ioutil.TempFile("", "dmesg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testLog)
+	f.Close()
+
+	var seqs []uint64
+	collect := func(r *Record) bool {
+		seqs = append(seqs, r.Seq)
+		return true
+	}
+	check := func(what string, want ...uint64) {
+		t.Helper()
+		if len(seqs) != len(want) {
+			t.Fatalf("%s: got %v, want %v", what, seqs, want)
+		}
+		for i := range want {
+			if seqs[i] != want[i] {
+				t.Fatalf("%s: got %v, want %v", what, seqs, want)
+			}
+		}
+		seqs = nil
+	}
+
+	fi := filter{re: regexp.MustCompile("fan tray")}
+	if _, err = scan(f.Name(), 0, &fi, collect); err != nil {
+		t.Fatal(err)
+	}
+	check("grep", 11, 15)
+
+	since, _ := time.ParseInLocation(TimeFormat, "2020-01-02 03:05:00",
+		time.Local)
+	until, _ := time.ParseInLocation(TimeFormat, "2020-01-02 03:06:30",
+		time.Local)
+	fi = filter{since: since, until: until}
+	scan(f.Name(), 0, &fi, collect)
+	check("since/until", 11, 11)
+
+	fi = filter{seq: 12}
+	scan(f.Name(), 0, &fi, collect)
+	check("seq", 15)
+
+	off, err := tailOffset(f.Name(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi = filter{}
+	end, _ := scan(f.Name(), off, &fi, collect)
+	check("tail", 11, 15)
+	if end != int64(len(testLog)) {
+		t.Fatal("end offset", end)
+	}
+
+	// from the middle of a line, start at the next one
+	scan(f.Name(), 5, &fi, collect)
+	check("byte", 11, 11, 15)
+}
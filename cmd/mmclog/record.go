@@ -0,0 +1,181 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mmclog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/mmclogd"
+)
+
+const TimeFormat = "2006-01-02 15:04:05"
+
+// Record is a line of the log as written by mmclogd:
+// SEQ [DATE TIME] [STAMP] MESSAGE
+type Record struct {
+	File  string
+	Byte  int64
+	Seq   uint64
+	Time  time.Time
+	Stamp string
+	Msg   string
+	line  string
+}
+
+var recordRe = regexp.MustCompile(`^([0-9]+) \[([^]]*)\] \[([^]]*)\] ?(.*)$`)
+
+// Parse splits a log line into its fields, returning false if it is not
+// in the expected format.
+func (r *Record) Parse(line string) bool {
+	r.line = line
+	m := recordRe.FindStringSubmatch(line)
+	if m == nil {
+		r.Msg = line
+		return false
+	}
+	r.Seq, _ = strconv.ParseUint(m[1], 10, 64)
+	r.Time, _ = time.ParseInLocation(TimeFormat, m[2], time.Local)
+	r.Stamp = m[3]
+	r.Msg = m[4]
+	return true
+}
+
+type filter struct {
+	since, until time.Time
+	seq          uint64
+	re           *regexp.Regexp
+}
+
+func (f *filter) active() bool {
+	return !f.since.IsZero() || !f.until.IsZero() || f.seq != 0 ||
+		f.re != nil
+}
+
+func (f *filter) match(r *Record, ok bool) bool {
+	if !ok && (!f.since.IsZero() || !f.until.IsZero() || f.seq != 0) {
+		return false
+	}
+	if !f.since.IsZero() && r.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && r.Time.After(f.until) {
+		return false
+	}
+	if f.seq != 0 && r.Seq < f.seq {
+		return false
+	}
+	return f.re == nil || f.re.MatchString(r.line)
+}
+
+// parseTime accepts an absolute time or a duration before now.
+func parseTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, TimeFormat,
+		"2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s: invalid time", s)
+}
+
+// scan calls out for each matching record of fn from byte start until out
+// returns false, and returns the offset following the last line read.
+// A partial line at start is skipped.
+func scan(fn string, start int64, f *filter,
+	out func(*Record) bool) (int64, error) {
+	rc, err := mmclogd.Open(fn)
+	if err != nil {
+		return start, err
+	}
+	defer rc.Close()
+
+	off := int64(0)
+	if start > 0 {
+		if sk, ok := rc.(io.Seeker); ok {
+			off, err = sk.Seek(start-1, io.SeekStart)
+		} else {
+			off, err = io.CopyN(ioutil.Discard, rc, start-1)
+		}
+		if err != nil {
+			return off, err
+		}
+	}
+	br := bufio.NewReader(rc)
+	if start > 0 {
+		// finish the line preceding start
+		s, err := br.ReadString('\n')
+		off += int64(len(s))
+		if err != nil {
+			return off, nilEOF(err)
+		}
+	}
+	for {
+		s, err := br.ReadString('\n')
+		if !strings.HasSuffix(s, "\n") {
+			// incomplete; leave it for a later read
+			return off, nilEOF(err)
+		}
+		r := Record{File: fn, Byte: off}
+		off += int64(len(s))
+		ok := r.Parse(strings.TrimSuffix(s, "\n"))
+		if f.match(&r, ok) && !out(&r) {
+			return off, nil
+		}
+	}
+}
+
+func nilEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// tailOffset returns the offset of the last count lines of a plain file.
+func tailOffset(fn string, count int) (int64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 4096)
+	end := fi.Size()
+	nl := 0
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		end -= n
+		if _, err = f.ReadAt(buf[:n], end); err != nil {
+			return 0, err
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				continue
+			}
+			// the final newline ends the last line
+			if nl++; nl == count+1 {
+				return end + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
@@ -5,7 +5,9 @@
 package mmclogd
 
 import (
+	"bufio"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -20,8 +22,8 @@ const (
 	LOGA          = "dmesg.txt"
 	LOGB          = "dmesg2.txt"
 	ENABLE        = "/tmp/mmclog_enable"
+	SEQFILE       = "dmesg.seq"
 	MAXLEN        = 4096
-	MAXMSG        = 50000
 	MAXSIZE int64 = 512 * 1024 * 1024
 	MMCDIR        = "/mnt"
 )
@@ -45,7 +47,14 @@ type Info struct {
 	pub     *publisher.Publisher
 	logA    string
 	logB    string
+	seqFile string
+	bootId  string
 	seq_end uint64
+	started bool
+	kmsg    *os.File
+	f       *os.File
+	w       *bufio.Writer
+	tidied  chan struct{}
 }
 
 func (*Command) String() string { return "mmclogd" }
@@ -62,7 +71,17 @@ func (*Command) Man() lang.Alt {
 	return lang.Alt{
 		lang.EnUS: `
 DESCRIPTION
-	mmclog daemon`,
+	mmclogd mounts the MMC card on ` + MMCDIR + ` and follows the kernel
+	log into ` + LOGA + `.
+
+	When it exceeds ` + strconv.Itoa(int(MAXSIZE>>20)) + `MiB, the log is
+	rotated to ` + LOGB + ` and older generations are renamed to
+	dmesg3.txt.gz, dmesg4.txt.gz and so on, compressed with gzip.
+	Compressed generations are removed, oldest first, to keep at most
+	` + strconv.Itoa(MAXGEN) + ` generations, none older than
+	` + strconv.Itoa(int(MAXAGE.Hours()/24)) + ` days, at most
+	` + strconv.Itoa(int(MAXTOTAL>>20)) + `MiB in total, and ` +
+			strconv.Itoa(int(MINFREE>>20)) + `MiB free on the card.`,
 	}
 }
 
@@ -81,7 +100,8 @@ func (c *Command) Main(...string) error {
 	for {
 		select {
 		case <-goes.Stop:
-			return nil
+			c.kmsg.Close()
+			return c.flushLogs()
 		case <-t.C:
 			if err := c.update(); err != nil {
 			}
@@ -94,7 +114,7 @@ func (c *Command) update() error {
 		return nil
 	}
 
-	if err := updateLogs(&c.Info); err != nil {
+	if err := c.flushLogs(); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,223 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mmclogd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/log"
+)
+
+const (
+	GZ  = ".gz"
+	TMP = ".tmp"
+)
+
+// Retention of rotated generations; the current and the first older
+// generation, dmesg.txt and dmesg2.txt, are always kept.
+var (
+	MAXGEN         = 10
+	MAXAGE         = 30 * 24 * time.Hour
+	MAXTOTAL int64 = 1024 * 1024 * 1024
+	MINFREE  int64 = 64 * 1024 * 1024
+)
+
+// GenName returns the file name of generation n, counting from 1 for the
+// current log.
+func GenName(dir string, n int) string {
+	switch n {
+	case 1:
+		return filepath.Join(dir, LOGA)
+	case 2:
+		return filepath.Join(dir, LOGB)
+	}
+	return filepath.Join(dir, "dmesg"+strconv.Itoa(n)+".txt")
+}
+
+// Generations lists the existing log files in dir, newest first. Rotated
+// generations end in .gz once compressed.
+func Generations(dir string) []string {
+	var gens []string
+	for n := 1; ; n++ {
+		fn := GenName(dir, n)
+		if _, err := os.Stat(fn + GZ); err == nil {
+			gens = append(gens, fn+GZ)
+		} else if _, err = os.Stat(fn); err == nil {
+			gens = append(gens, fn)
+		} else if n > 2 {
+			return gens
+		}
+	}
+}
+
+// Open returns a reader of a log generation, decompressing if needed.
+func Open(fn string) (io.ReadCloser, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(fn, GZ) {
+		return f, nil
+	}
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return &gzFile{z, f}, nil
+}
+
+type gzFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// shift renames generations 2 and older up by one, leaving generation 2
+// free for the current log. It returns the uncompressed name that now needs
+// compression, if any.
+func shift(dir string) (string, error) {
+	gens := Generations(dir)
+	for n := len(gens); n >= 2; n-- {
+		fn := gens[n-1]
+		to := GenName(dir, n+1)
+		if strings.HasSuffix(fn, GZ) {
+			to += GZ
+		}
+		if err := os.Rename(fn, to); err != nil {
+			return "", err
+		}
+	}
+	if len(gens) < 2 {
+		return "", nil
+	}
+	return GenName(dir, 3), nil
+}
+
+// compress replaces fn with fn.gz.
+func compress(fn string) error {
+	in, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(fn + GZ + TMP)
+	if err != nil {
+		return err
+	}
+	z := gzip.NewWriter(out)
+	_, err = io.Copy(z, in)
+	if err == nil {
+		err = z.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	out.Close()
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	if err = os.Rename(out.Name(), fn+GZ); err != nil {
+		return err
+	}
+	return os.Remove(fn)
+}
+
+// prune removes the oldest rotated generations until the count, age, total
+// size and free space limits are met.
+func prune(dir string) error {
+	gens := Generations(dir)
+	var total int64
+	sizes := make([]int64, len(gens))
+	for i, fn := range gens {
+		if fi, err := os.Stat(fn); err == nil {
+			sizes[i] = fi.Size()
+			total += sizes[i]
+		}
+	}
+	for n := len(gens); n > 2; n-- {
+		fn := gens[n-1]
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return err
+		}
+		if n <= MAXGEN && time.Since(fi.ModTime()) <= MAXAGE &&
+			total <= MAXTOTAL && freeSpace(dir) >= MINFREE {
+			break
+		}
+		if err = os.Remove(fn); err != nil {
+			return err
+		}
+		total -= sizes[n-1]
+	}
+	return nil
+}
+
+func freeSpace(dir string) int64 {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return MINFREE
+	}
+	return int64(st.Bavail) * int64(st.Bsize)
+}
+
+// tidy removes what an interrupted compress left, compresses fn, if any,
+// and prunes the generations in dir.
+func tidy(dir, fn string) {
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*"+GZ+TMP))
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+	if fn != "" {
+		if err := compress(fn); err != nil {
+			log.Print("mmclogd: ", err)
+		}
+	}
+	if err := prune(dir); err != nil {
+		log.Print("mmclogd: ", err)
+	}
+}
+
+// rotate moves the current log to generation 2, then compresses and prunes
+// the older generations without holding up the follower. It first waits
+// for those of the previous rotation, so that shift doesn't rename a
+// generation being compressed.
+func (c *Info) rotate() error {
+	if c.tidied != nil {
+		<-c.tidied
+	}
+	c.f.Close()
+	dir := filepath.Dir(c.logA)
+	fn, err := shift(dir)
+	if err == nil {
+		err = os.Rename(c.logA, c.logB)
+	}
+	if oerr := c.openLog(); err == nil {
+		err = oerr
+	}
+	if err != nil {
+		return err
+	}
+	tidied := make(chan struct{})
+	c.tidied = tidied
+	go func() {
+		defer close(tidied)
+		tidy(dir, fn)
+	}()
+	return nil
+}
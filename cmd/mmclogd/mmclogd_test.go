@@ -1,7 +1,10 @@
 package mmclogd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +31,128 @@ func TestRmFile(t *testing.T) {
 		return
 	}
 }
+
+func TestAppendGap(t *testing.T) {
+	f, err := ioutil.TempFile("", "dmesg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	defer func(fn string) { bootIdFile = fn }(bootIdFile)
+	bootIdFile = f.Name() + ".boot"
+	defer os.Remove(bootIdFile)
+	err = ioutil.WriteFile(bootIdFile, []byte("boot-1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Info{logA: f.Name(), seqFile: f.Name() + ".seq"}
+	defer os.Remove(c.seqFile)
+	if err = c.openLog(); err != nil {
+		t.Fatal(err)
+	}
+	c.loadSeq()
+	for _, rec := range []string{
+		"6,10,1000,-;first",
+		"6,10,1000,-;duplicate",
+		"6,11,2000,-;second",
+		"6,15,3000,-;after overrun",
+	} {
+		if err = c.append([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = c.flushLogs(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(c.logA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "10 ") ||
+		!strings.HasSuffix(lines[0], "first") ||
+		!strings.HasSuffix(lines[2], "3 messages lost") ||
+		!strings.HasPrefix(lines[3], "15 ") {
+		t.Fatalf("unexpected log %q", lines)
+	}
+
+	c.bootId, c.seq_end, c.started = "", 0, false
+	c.loadSeq()
+	if c.bootId != "boot-1" || c.seq_end != 15 || !c.started {
+		t.Fatalf("sequence not restored, got %q %d", c.bootId,
+			c.seq_end)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmclogd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Info{logA: GenName(dir, 1), logB: GenName(dir, 2)}
+	if err = c.openLog(); err != nil {
+		t.Fatal(err)
+	}
+	leftover := GenName(dir, 3) + GZ + TMP
+	if err = ioutil.WriteFile(leftover, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		fmt.Fprintln(c.w, "generation", i)
+		c.w.Flush()
+		if err = c.rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-c.tidied
+	c.f.Close()
+	if _, err = os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("leftover", leftover, err)
+	}
+
+	gens := Generations(dir)
+	if len(gens) != 5 || !strings.HasSuffix(gens[4], "dmesg5.txt"+GZ) {
+		t.Fatalf("unexpected generations %q", gens)
+	}
+	r, err := Open(gens[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "generation 0\n" {
+		t.Fatalf("oldest generation: %q %v", b, err)
+	}
+
+	MAXGEN = 3
+	defer func() { MAXGEN = 10 }()
+	if err = prune(dir); err != nil {
+		t.Fatal(err)
+	}
+	if gens = Generations(dir); len(gens) != 3 {
+		t.Fatalf("prune left %q", gens)
+	}
+}
+
+func TestTidying(t *testing.T) {
+	c := &Info{}
+	if c.tidying() {
+		t.Error("tidying before any rotation")
+	}
+	c.tidied = make(chan struct{})
+	if !c.tidying() {
+		t.Error("not tidying while tidy runs")
+	}
+	close(c.tidied)
+	if c.tidying() {
+		t.Error("tidying after tidy")
+	}
+}
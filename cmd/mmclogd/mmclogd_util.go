@@ -5,6 +5,8 @@
 package mmclogd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -24,14 +26,13 @@ const (
 	lb = "["
 	rb = "]"
 
-	MaxEpollEvents = 32
-	KB             = 1024 * 64
+	BUFSIZE = 64 * 1024
 )
 
 func initLogging(c *Info) error {
 	c.logA = MMCDIR + "/" + LOGA
 	c.logB = MMCDIR + "/" + LOGB
-	c.seq_end = 0
+	c.seqFile = MMCDIR + "/" + SEQFILE
 
 	exists, err := detectMMC()
 	if err != nil {
@@ -51,18 +52,15 @@ func initLogging(c *Info) error {
 	if err != nil {
 		return err
 	}
-	if err = startTicker(); err != nil {
+	if err = c.openLog(); err != nil {
 		return err
 	}
-	return nil
-}
-
-func updateLogs(c *Info) (err error) {
-	err, msg := getNewDmesg(c)
-	if err != nil {
+	c.loadSeq()
+	if c.kmsg, err = os.Open(log.DevKmsg); err != nil {
 		return err
 	}
-	if err := createAppend(c, msg); err != nil {
+	go follow(c, c.kmsg)
+	if err = startTicker(); err != nil {
 		return err
 	}
 	return nil
@@ -100,99 +98,142 @@ func stopTicker() error {
 	return nil
 }
 
-func getNewDmesg(c *Info) (error, []string) {
-	var event syscall.EpollEvent
-	var events [MaxEpollEvents]syscall.EpollEvent
-	var buf [KB]byte
+// follow copies /dev/kmsg records to the log until the device is closed.
+func follow(c *Info, f *os.File) {
+	buf := make([]byte, MAXLEN)
+	for {
+		n, err := f.Read(buf)
+		if errors.Is(err, syscall.EPIPE) {
+			// overrun; the next record's sequence shows the gap
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if err = c.append(buf[:n]); err != nil {
+			log.Print("mmclogd: ", err)
+		}
+	}
+}
+
+// append formats a kmsg record, preceded by a marker if records were lost.
+func (c *Info) append(b []byte) error {
 	var kmsg log.Kmsg
 	var si syscall.Sysinfo_t
-	msg := make([]string, MAXMSG)
-	defer func() { msg = msg[:0] }()
 
-	f, err := os.Open("/dev/kmsg")
-	if err != nil {
-		return err, nil
-	}
-	defer f.Close()
+	kmsg.Parse(b)
+	seq := uint64(kmsg.Seq)
 
-	fd := int(f.Fd())
-	if err = syscall.SetNonblock(fd, true); err != nil {
-		return err, nil
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.started && seq <= c.seq_end {
+		return nil
 	}
-	epfd, err := syscall.EpollCreate1(0)
-	if err != nil {
-		return err, nil
+	syscall.Sysinfo(&si)
+	now := time.Now()
+	tim := kmsg.Stamp.Time(now, int64(si.Uptime))
+	ts := lb + tim.Format("2006-01-02 15:04:05") + rb
+	if c.started && seq > c.seq_end+1 {
+		lost := seq - c.seq_end - 1
+		_, err := fmt.Fprint(c.w, seq-1, sp, ts, sp, lb, "gap", rb, sp,
+			lost, " messages lost", nl)
+		if err != nil {
+			return err
+		}
 	}
-	defer syscall.Close(epfd)
+	c.started = true
+	c.seq_end = seq
+	_, err := fmt.Fprint(c.w, seq, sp, ts, sp, lb, kmsg.Stamp, rb, sp,
+		kmsg.Msg, nl)
+	return err
+}
 
-	event.Events = syscall.EPOLLIN
-	event.Fd = int32(fd)
-	err = syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &event)
+// openLog opens the current log generation behind the buffered writer.
+func (c *Info) openLog() (err error) {
+	mode := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	c.f, err = os.OpenFile(c.logA, mode, 0666)
 	if err != nil {
-		return err, nil
+		return err
 	}
-	nevents, err := syscall.EpollWait(epfd, events[:], -1)
-	if err != nil {
-		return err, nil
-	}
-	for ev := 0; ev < nevents; ev++ {
-		i := 0
-		for {
-			nbytes, err := syscall.Read(int(events[ev].Fd), buf[:])
-			if nbytes > 0 {
-				kmsg.Parse(buf[:nbytes])
-				ksq := strconv.Itoa(int(kmsg.Seq))
-
-				now := time.Now()
-				tim := time.Time(kmsg.Stamp.Time(now, int64(si.Uptime)))
-				kst := fmt.Sprintln(tim)
-				ksu := strings.Split(kst, ".")
-
-				kmg := fmt.Sprint(sp, lb, kmsg.Stamp, rb, sp)
-				if uint64(kmsg.Seq) > c.seq_end {
-					fs := ksq + sp + lb + ksu[0] + rb + kmg + kmsg.Msg
-					msg[i] = fmt.Sprintln(fs)
-					i++
-					c.seq_end = uint64(kmsg.Seq)
-				}
-			}
-			if err != nil {
-				break
-			}
-		}
+	if c.w == nil {
+		c.w = bufio.NewWriterSize(c.f, BUFSIZE)
+	} else {
+		c.w.Reset(c.f)
 	}
-	return nil, msg
+	return nil
 }
 
-func createAppend(c *Info, msg []string) error {
-	mode := os.O_CREATE | os.O_APPEND | os.O_WRONLY
-	f, err := os.OpenFile(c.logA, mode, 0666)
-	if err != nil {
+// flushLogs writes buffered messages, saves the last sequence number and
+// rotates the log when it is full. Short of space, it prunes unless a
+// rotation is still tidying, since prune could remove a generation as it's
+// compressed.
+func (c *Info) flushLogs() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.w == nil {
+		return nil
+	}
+	if err := c.w.Flush(); err != nil {
 		return err
 	}
-	defer f.Close()
-	for i, _ := range msg {
-		_, err = f.Write([]byte(msg[i]))
-		if err != nil {
+	c.f.Sync()
+	if c.started {
+		s := fmt.Sprint(c.bootId, sp, c.seq_end, nl)
+		if err := ioutil.WriteFile(c.seqFile, []byte(s), 0644); err != nil {
 			return err
 		}
 	}
-	f.Sync()
-	f.Close()
-	fi, err := os.Stat(c.logA)
+	fi, err := c.f.Stat()
 	if err != nil {
 		return err
 	}
 	if fi.Size() > MAXSIZE {
-		rmFile(c.logB)
-		err := os.Rename(c.logA, c.logB)
-		if err != nil {
-			return err
-		}
+		return c.rotate()
+	}
+	if freeSpace(MMCDIR) < MINFREE && !c.tidying() {
+		return prune(MMCDIR)
 	}
 	return nil
 }
 
+// tidying is true while the previous rotation's generations are being
+// compressed; its tidy prunes them when done.
+func (c *Info) tidying() bool {
+	if c.tidied == nil {
+		return false
+	}
+	select {
+	case <-c.tidied:
+		return false
+	default:
+		return true
+	}
+}
+
+// bootIdFile identifies this boot.
+var bootIdFile = "/proc/sys/kernel/random/boot_id"
+
+// loadSeq restores the last logged sequence number if it is from this boot.
+func (c *Info) loadSeq() {
+	b, err := ioutil.ReadFile(bootIdFile)
+	if err != nil {
+		return
+	}
+	c.bootId = strings.TrimSpace(string(b))
+	b, err = ioutil.ReadFile(c.seqFile)
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 || fields[0] != c.bootId {
+		return
+	}
+	if u, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+		c.seq_end = u
+		c.started = true
+	}
+}
+
 func LogDmesg(n int) error {
 	if n < 1 || n > 100000 {
 		return fmt.Errorf("value must be between 1 - 100,000")
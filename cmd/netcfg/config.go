@@ -0,0 +1,285 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package netcfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	Machine = "platina-mk1-bmc"
+	Dev     = "eth0"
+
+	ConfigFile = "/etc/goes/netcfg.json"
+	StartFile  = "/etc/goes/start"
+	PerFile    = "/boot/" + Machine + "-per.bin"
+	ResolvFile = "/etc/resolv.conf"
+
+	ModeDhcp  = "dhcp"
+	ModeSlaac = "slaac"
+	ModeNone  = "none"
+)
+
+// Config is the configured state of the management interface. IPv4 is
+// dhcp, none or ADDRESS/PREFIX; IPv6 is slaac, none or ADDRESS/PREFIX.
+type Config struct {
+	Hostname string   `json:",omitempty"`
+	Vlan     int      `json:",omitempty"`
+	IPv4     string   `json:",omitempty"`
+	Gateway4 string   `json:",omitempty"`
+	IPv6     string   `json:",omitempty"`
+	Gateway6 string   `json:",omitempty"`
+	DNS      []string `json:",omitempty"`
+}
+
+// Load returns the saved configuration. If there is none, the legacy ip=
+// string from the -per.bin file is converted instead.
+func Load() (*Config, error) {
+	b, err := ioutil.ReadFile(ConfigFile)
+	if err == nil {
+		c := &Config{}
+		if err = json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("%s: %w", ConfigFile, err)
+		}
+		return c, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	per, err := ioutil.ReadFile(PerFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{IPv4: ModeDhcp}, nil
+		}
+		return nil, err
+	}
+	return ParseLegacy(strings.TrimRight(string(per), "\x00")), nil
+}
+
+// ParseLegacy converts a kernel style
+// CLIENT:SERVER:GATEWAY:NETMASK:HOSTNAME:DEVICE:AUTOCONF string.
+func ParseLegacy(per string) *Config {
+	c := &Config{}
+	ipS := strings.Split(per, ":")
+	switch ipS[0] {
+	case "dhcp", "bootp", "rarp", "both", "any", "on":
+		c.IPv4 = ModeDhcp
+		return c
+	case "", "off", "none":
+		c.IPv4 = ModeNone
+		return c
+	}
+	ones := 32
+	if len(ipS) > 3 {
+		if nm := net.ParseIP(ipS[3]); nm != nil {
+			if nm4 := nm.To4(); nm4 != nil {
+				mask := net.IPv4Mask(nm4[0], nm4[1], nm4[2], nm4[3])
+				if n, bits := mask.Size(); bits == net.IPv4len*8 {
+					ones = n
+				}
+			}
+		}
+	}
+	c.IPv4 = ipS[0] + "/" + strconv.Itoa(ones)
+	if len(ipS) > 2 {
+		c.Gateway4 = ipS[2]
+	}
+	if len(ipS) > 4 {
+		c.Hostname = ipS[4]
+	}
+	return c
+}
+
+// Validate checks the configuration for consistency.
+func (c *Config) Validate() error {
+	if c.Hostname != "" && !validHostname(c.Hostname) {
+		return fmt.Errorf("%s: invalid hostname", c.Hostname)
+	}
+	if c.Vlan < 0 || c.Vlan > 4094 {
+		return fmt.Errorf("vlan %d: must be between 1 and 4094", c.Vlan)
+	}
+	switch c.IPv4 {
+	case "", ModeNone, ModeDhcp:
+		if c.Gateway4 != "" {
+			return fmt.Errorf("ipv4 gateway requires a static address")
+		}
+	default:
+		ip, _, err := net.ParseCIDR(c.IPv4)
+		if err != nil || ip.To4() == nil {
+			return fmt.Errorf("%s: invalid ipv4 address", c.IPv4)
+		}
+		if c.Gateway4 != "" {
+			gw := net.ParseIP(c.Gateway4)
+			if gw == nil || gw.To4() == nil {
+				return fmt.Errorf("%s: invalid ipv4 gateway",
+					c.Gateway4)
+			}
+		}
+	}
+	switch c.IPv6 {
+	case "", ModeNone, ModeSlaac:
+	default:
+		ip, _, err := net.ParseCIDR(c.IPv6)
+		if err != nil || ip.To4() != nil {
+			return fmt.Errorf("%s: invalid ipv6 address", c.IPv6)
+		}
+	}
+	if c.Gateway6 != "" {
+		gw := net.ParseIP(c.Gateway6)
+		if gw == nil || gw.To4() != nil {
+			return fmt.Errorf("%s: invalid ipv6 gateway", c.Gateway6)
+		}
+		if c.IPv6 == "" || c.IPv6 == ModeNone {
+			return fmt.Errorf("ipv6 gateway requires ipv6")
+		}
+	}
+	for _, s := range c.DNS {
+		if net.ParseIP(s) == nil {
+			return fmt.Errorf("%s: invalid dns server", s)
+		}
+	}
+	return nil
+}
+
+func validHostname(s string) bool {
+	if len(s) > 63 {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9':
+		case r == '-' && i > 0 && i < len(s)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Link is the interface carrying the addresses, eth0 or its vlan.
+func (c *Config) Link() string {
+	if c.Vlan != 0 {
+		return Dev + "." + strconv.Itoa(c.Vlan)
+	}
+	return Dev
+}
+
+// Legacy returns the ip= string used by firmware without persistent
+// storage. Only IPv4 can be expressed there.
+func (c *Config) Legacy() string {
+	switch c.IPv4 {
+	case ModeDhcp:
+		return "dhcp"
+	case "", ModeNone:
+		return "off"
+	}
+	ip, ipnet, err := net.ParseCIDR(c.IPv4)
+	if err != nil {
+		return "off"
+	}
+	m := ipnet.Mask
+	mask := fmt.Sprintf("%d.%d.%d.%d", m[0], m[1], m[2], m[3])
+	return strings.Join([]string{ip.String(), "", c.Gateway4, mask,
+		c.Hostname, Dev, "off"}, ":")
+}
+
+// Script returns the goes commands that apply the configuration at boot.
+func (c *Config) Script() []byte {
+	dev := c.Link()
+	outstr := ""
+	if c.Hostname != "" {
+		outstr += fmt.Sprintf("echo %s > /proc/sys/kernel/hostname\n",
+			c.Hostname)
+	}
+	if c.IPv4 == "" && c.IPv6 == "" {
+		return []byte(outstr)
+	}
+	outstr += fmt.Sprintf("ip link %s change up\n", Dev)
+	if c.Vlan != 0 {
+		outstr += fmt.Sprintf(`ip link add type vlan name %s link %s id %d
+ip link %s change up
+`,
+			dev, Dev, c.Vlan, dev)
+	}
+	switch c.IPv4 {
+	case "", ModeNone:
+	case ModeDhcp:
+		if dev == Dev {
+			outstr += "daemons start dhcpcd\n"
+		} else {
+			outstr += fmt.Sprintf("daemons start dhcpcd -i %s\n", dev)
+		}
+	default:
+		outstr += fmt.Sprintf("ip address add %s dev %s\n", c.IPv4, dev)
+		if c.Gateway4 != "" {
+			outstr += fmt.Sprintf("ip route add 0.0.0.0/0 via %s\n",
+				c.Gateway4)
+		}
+	}
+	sysctl := "/proc/sys/net/ipv6/conf/" + dev + "/"
+	switch c.IPv6 {
+	case "":
+	case ModeNone:
+		outstr += fmt.Sprintf("echo 1 > %sdisable_ipv6\n", sysctl)
+	case ModeSlaac:
+		outstr += fmt.Sprintf(`echo 1 > %saccept_ra
+echo 1 > %sautoconf
+`,
+			sysctl, sysctl)
+	default:
+		outstr += fmt.Sprintf(`echo 0 > %sautoconf
+ip address add %s dev %s
+`,
+			sysctl, c.IPv6, dev)
+	}
+	if c.Gateway6 != "" {
+		outstr += fmt.Sprintf("ip route add ::/0 via %s\n", c.Gateway6)
+	}
+	return []byte(outstr)
+}
+
+// Resolv returns the resolv.conf contents, empty without DNS servers.
+func (c *Config) Resolv() []byte {
+	outstr := ""
+	for _, s := range c.DNS {
+		outstr += "nameserver " + s + "\n"
+	}
+	return []byte(outstr)
+}
+
+// Store writes the configuration file only.
+func (c *Config) Store() error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ConfigFile, append(b, '\n'), 0644)
+}
+
+// Save validates and stores the configuration, then regenerates the legacy
+// ip= string, the start script and resolv.conf from it.
+func (c *Config) Save() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if err := c.Store(); err != nil {
+		return err
+	}
+	err := ioutil.WriteFile(PerFile, []byte(c.Legacy()+"\x00"), 0644)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(StartFile, c.Script(), 0644); err != nil {
+		return fmt.Errorf("Error writing %s: %w", StartFile, err)
+	}
+	return ioutil.WriteFile(ResolvFile, c.Resolv(), 0644)
+}
@@ -0,0 +1,254 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package netcfg configures the bmc management interface.
+package netcfg
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/platinasystems/flags"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/parms"
+)
+
+type Command struct{}
+
+// options are applied in this order, so -ip4 dhcp clears the gateway before
+// -gw4 sets it, and -ip6 none clears the ipv6 gateway.
+var options = []string{"-ip4", "-gw4", "-ip6", "-gw6", "-dns", "-hostname",
+	"-vlan"}
+
+func (Command) String() string { return "netcfg" }
+
+func (Command) Usage() string {
+	return `netcfg [-ip4 ADDR/LEN|dhcp|none] [-gw4 ADDR] \
+	[-ip6 ADDR/LEN|slaac|none] [-gw6 ADDR] [-dns ADDR[,ADDR]...] \
+	[-hostname NAME] [-vlan ID] [-reset] [-legacy]`
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "configure the bmc management network",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	The netcfg command configures the management interface, eth0.
+
+	Without options, the configured and the effective (running) state
+	are displayed.
+
+	Any option updates the configured state, which is validated and
+	stored in ` + ConfigFile + `. The start script, ` + StartFile + `,
+	and the legacy ip= string in ` + PerFile + ` are regenerated
+	from it so that both agree. Changes take effect on the next boot.
+
+	The legacy ip= string can only represent the IPv4 configuration;
+	it is used when installing firmware without persistent storage.
+
+	SLAAC enables router advertisements on the link. There is no
+	DHCPv6 client, so stateful DHCPv6 addressing isn't supported.
+
+	Without DNS servers, resolv.conf is emptied; with dhcp, the DHCP
+	client fills it in at the next boot.
+
+OPTIONS
+	-ip4 ADDR/LEN|dhcp|none		IPv4 address, dhcp, or none
+	-gw4 ADDR			IPv4 default route
+	-ip6 ADDR/LEN|slaac|none		IPv6 address or autoconfiguration
+	-gw6 ADDR			IPv6 default route
+	-dns ADDR[,ADDR]...		name servers, "none" to clear
+	-hostname NAME			host name, "none" to clear
+	-vlan ID			tag management traffic, 0 to clear
+	-reset				start over from dhcp defaults
+	-legacy				print the legacy ip= string
+
+EXAMPLES
+	netcfg -ip4 192.168.101.241/24 -gw4 192.168.101.2 -dns 192.168.101.2
+	netcfg -ip4 dhcp -ip6 slaac -hostname bmc1`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-reset", "-legacy")
+	parm, args := parms.New(args, "-ip4", "-gw4", "-ip6", "-gw6", "-dns",
+		"-hostname", "-vlan")
+	if len(args) > 0 {
+		return fmt.Errorf("%v: unexpected", args)
+	}
+
+	c, err := Load()
+	if err != nil {
+		return err
+	}
+	if flag.ByName["-legacy"] {
+		fmt.Println("ip=" + c.Legacy())
+		return nil
+	}
+
+	update := flag.ByName["-reset"]
+	if update {
+		c = &Config{IPv4: ModeDhcp}
+	}
+	for _, k := range options {
+		v := parm.ByName[k]
+		if v == "" {
+			continue
+		}
+		update = true
+		switch k {
+		case "-ip4":
+			c.IPv4 = v
+			if v == ModeDhcp || v == ModeNone {
+				c.Gateway4 = ""
+			}
+		case "-gw4":
+			c.Gateway4 = v
+		case "-ip6":
+			c.IPv6 = v
+			if v == ModeNone {
+				c.Gateway6 = ""
+			}
+		case "-gw6":
+			c.Gateway6 = v
+		case "-dns":
+			c.DNS = nil
+			if v != ModeNone {
+				c.DNS = strings.Split(v, ",")
+			}
+		case "-hostname":
+			c.Hostname = v
+			if v == ModeNone {
+				c.Hostname = ""
+			}
+		case "-vlan":
+			if c.Vlan, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf("%s: invalid vlan", v)
+			}
+		}
+	}
+	if !update {
+		show(c)
+		return nil
+	}
+	return c.Save()
+}
+
+func show(c *Config) {
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	vlan := "-"
+	if c.Vlan != 0 {
+		vlan = strconv.Itoa(c.Vlan)
+	}
+	host, _ := os.Hostname()
+	v4, v6 := effectiveAddrs(c.Link())
+	gw4, gw6 := effectiveRoutes()
+
+	fmt.Printf("%-10s %-30s %s\n", "", "configured", "effective")
+	fmt.Printf("%-10s %-30s %s\n", "hostname", dash(c.Hostname), dash(host))
+	fmt.Printf("%-10s %-30s %s\n", "vlan", vlan, c.Link())
+	fmt.Printf("%-10s %-30s %s\n", "ipv4", dash(c.IPv4),
+		dash(strings.Join(v4, " ")))
+	fmt.Printf("%-10s %-30s %s\n", "gateway4", dash(c.Gateway4), dash(gw4))
+	fmt.Printf("%-10s %-30s %s\n", "ipv6", dash(c.IPv6),
+		dash(strings.Join(v6, " ")))
+	fmt.Printf("%-10s %-30s %s\n", "gateway6", dash(c.Gateway6), dash(gw6))
+	fmt.Printf("%-10s %-30s %s\n", "dns", dash(strings.Join(c.DNS, ",")),
+		dash(strings.Join(effectiveDNS(), ",")))
+}
+
+func effectiveAddrs(dev string) (v4, v6 []string) {
+	itf, err := net.InterfaceByName(dev)
+	if err != nil {
+		return
+	}
+	addrs, err := itf.Addrs()
+	if err != nil {
+		return
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			v4 = append(v4, ipnet.String())
+		} else {
+			v6 = append(v6, ipnet.String())
+		}
+	}
+	return
+}
+
+// effectiveRoutes returns the default gateways from the kernel tables.
+func effectiveRoutes() (gw4, gw6 string) {
+	if f, err := os.Open("/proc/net/route"); err == nil {
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			fields := strings.Fields(scan.Text())
+			if len(fields) < 3 || fields[1] != "00000000" {
+				continue
+			}
+			u, err := strconv.ParseUint(fields[2], 16, 32)
+			if err != nil {
+				continue
+			}
+			// little endian hex
+			gw4 = net.IPv4(byte(u), byte(u>>8), byte(u>>16),
+				byte(u>>24)).String()
+			break
+		}
+		f.Close()
+	}
+	if f, err := os.Open("/proc/net/ipv6_route"); err == nil {
+		scan := bufio.NewScanner(f)
+		for scan.Scan() {
+			fields := strings.Fields(scan.Text())
+			if len(fields) < 5 || fields[1] != "00" ||
+				strings.Trim(fields[4], "0") == "" {
+				continue
+			}
+			ip := make(net.IP, net.IPv6len)
+			for i := range ip {
+				u, _ := strconv.ParseUint(fields[4][2*i:2*i+2],
+					16, 8)
+				ip[i] = byte(u)
+			}
+			gw6 = ip.String()
+			break
+		}
+		f.Close()
+	}
+	return
+}
+
+func effectiveDNS() (servers []string) {
+	f, err := os.Open(ResolvFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) > 1 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return
+}
@@ -0,0 +1,63 @@
+package netcfg
+
+import (
+	"fmt"
+)
+
+func ExampleParseLegacy() {
+	c := ParseLegacy("172.17.3.52::172.17.2.1:255.255.254.0:bmc1:eth0:on")
+	fmt.Println(c.Validate())
+	fmt.Println(c.Legacy())
+	fmt.Print(string(c.Script()))
+	// Output:
+	// <nil>
+	// 172.17.3.52::172.17.2.1:255.255.254.0:bmc1:eth0:off
+	// echo bmc1 > /proc/sys/kernel/hostname
+	// ip link eth0 change up
+	// ip address add 172.17.3.52/23 dev eth0
+	// ip route add 0.0.0.0/0 via 172.17.2.1
+}
+
+func ExampleConfig_Script() {
+	c := &Config{
+		Vlan:     10,
+		IPv4:     ModeDhcp,
+		IPv6:     "2001:db8::10/64",
+		Gateway6: "2001:db8::1",
+	}
+	fmt.Println(c.Validate())
+	fmt.Println(c.Legacy())
+	fmt.Print(string(c.Script()))
+	// Output:
+	// <nil>
+	// dhcp
+	// ip link eth0 change up
+	// ip link add type vlan name eth0.10 link eth0 id 10
+	// ip link eth0.10 change up
+	// daemons start dhcpcd -i eth0.10
+	// echo 0 > /proc/sys/net/ipv6/conf/eth0.10/autoconf
+	// ip address add 2001:db8::10/64 dev eth0.10
+	// ip route add ::/0 via 2001:db8::1
+}
+
+func ExampleConfig_Validate() {
+	for _, c := range []*Config{
+		{IPv4: "10.0.0.1"},
+		{IPv4: ModeDhcp, Gateway4: "10.0.0.254"},
+		{IPv6: "10.0.0.1/24"},
+		{IPv6: "dhcpv6"},
+		{IPv4: "10.0.0.1/24", DNS: []string{"dns.example"}},
+		{Hostname: "-bmc"},
+		{Vlan: 4095},
+	} {
+		fmt.Println(c.Validate())
+	}
+	// Output:
+	// 10.0.0.1: invalid ipv4 address
+	// ipv4 gateway requires a static address
+	// 10.0.0.1/24: invalid ipv6 address
+	// dhcpv6: invalid ipv6 address
+	// dns.example: invalid dns server
+	// -bmc: invalid hostname
+	// vlan 4095: must be between 1 and 4094
+}
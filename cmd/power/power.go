@@ -0,0 +1,76 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package power
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/powerd"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/lang"
+)
+
+// Timeout bounds the wait for an operation to finish.
+const Timeout = 10 * time.Second
+
+type Command struct{}
+
+func (Command) String() string { return "power" }
+
+func (Command) Usage() string { return "power [on|off|cycle|reset|status]" }
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "control host power",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	The power command asks powerd to turn the host on or off, cycle its
+	power or reset it, then prints the host's power state once the
+	operation is done. Without an operation, or with status, it prints
+	the state: off, powering-off, powering-on, on or resetting.
+
+	An operation is refused while another is in progress.`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	op := "status"
+	switch len(args) {
+	case 0:
+	case 1:
+		op = args[0]
+	default:
+		return fmt.Errorf("%v: unexpected", args[1:])
+	}
+	if op == "status" {
+		s, err := redis.Hget(redis.DefaultHash, "host.power.state")
+		if err != nil {
+			return err
+		}
+		fmt.Println(s)
+		return nil
+	}
+	if err := powerd.Request(op); err != nil {
+		return err
+	}
+	for t := time.Now(); time.Since(t) < Timeout; {
+		time.Sleep(100 * time.Millisecond)
+		s, err := redis.Hget(redis.DefaultHash, "host.power.state")
+		if err != nil {
+			return err
+		}
+		if s == powerd.On || s == powerd.Off {
+			fmt.Println(s)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: timeout", op)
+}
@@ -0,0 +1,312 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package powerd owns the gpios that power and reset the host. Power
+// operations are requested by writing host.power, and their progress is
+// published as host.power.state. After an AC loss, powerd turns the host
+// on or off as host.power.restore_policy says.
+//
+// fspd also drives the supplies' enables, for psuN.admin.state, so powerd
+// follows them: if they turn the host off or on, it finishes the operation,
+// stopping or restarting i2c, as if it had been requested.
+package powerd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/external/redis/rpc/args"
+	"github.com/platinasystems/goes/external/redis/rpc/reply"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/gpio"
+)
+
+// States of host.power.state.
+const (
+	Off         = "off"
+	PoweringOff = "powering-off"
+	PoweringOn  = "powering-on"
+	On          = "on"
+	Resetting   = "resetting"
+)
+
+// Operations written to host.power.
+var Operations = []string{"on", "off", "cycle", "reset"}
+
+var (
+	// GpioPwronL enable the power supplies' outputs.
+	GpioPwronL = []string{"PSU0_PWRON_L", "PSU1_PWRON_L"}
+
+	// GpioHostRstL resets the host.
+	GpioHostRstL = "BMC_TO_HOST_RST_L"
+
+	// GpioEthxRstL resets the ethernet switch after power on.
+	GpioEthxRstL = "ETHX_RST_L"
+)
+
+// Request asks powerd to turn the host on or off, cycle or reset it. It
+// fails if powerd is busy with a conflicting operation.
+func Request(op string) error {
+	_, err := redis.Hset(redis.DefaultHash, "host.power", op)
+	return err
+}
+
+var command *Command
+
+func init() {
+	daemon.Writable("powerd",
+		daemon.Key{
+			Name:   "host.power",
+			Type:   daemon.EnumKey,
+			Values: Operations,
+			Set: func(v interface{}) error {
+				return command.request(v.(string))
+			},
+		},
+		daemon.Key{
+			Name:   "host.power.restore_policy",
+			Type:   daemon.EnumKey,
+			Values: RestorePolicies,
+			Set: func(v interface{}) error {
+				return command.setPolicy(v.(string))
+			},
+		},
+	)
+}
+
+type Command struct {
+	Info
+	Init func()
+	init sync.Once
+
+	state string
+	steps []step
+	next  time.Time
+
+	settings *Settings
+	restored bool
+	started  time.Time
+	// sensed is the host's state when powerd started.
+	sensed string
+}
+
+type Info struct {
+	mutex sync.Mutex
+	d     *daemon.Daemon
+}
+
+// step is a part of an operation, done after the previous, which leaves
+// the host in state, if not "".
+type step struct {
+	after time.Duration
+	do    func() error
+	state string
+}
+
+func (*Command) String() string { return "powerd" }
+
+func (*Command) Usage() string { return "powerd" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "host power daemon, publishes to redis",
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(...string) error {
+	command = c
+	if c.Init != nil {
+		c.init.Do(c.Init)
+	}
+
+	c.d = daemon.New("powerd")
+	if err := c.d.Start(&c.Info); err != nil {
+		return err
+	}
+	var err error
+	c.settings, err = loadSettings()
+	c.d.Check("load", err)
+	c.started = time.Now()
+	c.sensed = sense()
+	c.setState(c.sensed)
+	c.d.Changed("host.power.restore_policy", c.settings.RestorePolicy)
+
+	return c.d.Run(daemon.Ticker{
+		Name:     "sequence",
+		Interval: 50 * time.Millisecond,
+		Func:     c.sequence,
+	}, daemon.Ticker{
+		Name:     "follow",
+		Interval: time.Second,
+		Func:     c.follow,
+	}, daemon.Ticker{
+		Name:     "restore",
+		Interval: 5 * time.Second,
+		Func:     c.restore,
+	})
+}
+
+// sense returns the state of the host from the supplies' enables.
+func sense() string {
+	for _, name := range GpioPwronL {
+		pin, found := gpio.FindPin(name)
+		if !found {
+			continue
+		}
+		if v, err := pin.Value(); err == nil && !v {
+			return On
+		}
+	}
+	return Off
+}
+
+func (c *Command) setState(s string) {
+	c.state = s
+	c.d.Changed("host.power.state", s)
+	c.record(s)
+}
+
+// request starts an operation unless another is in progress.
+func (c *Command) request(op string) error {
+	if len(c.steps) > 0 {
+		return fmt.Errorf("host is %s", c.state)
+	}
+	var steps []step
+	switch op {
+	case "on":
+		if c.state == On {
+			return nil
+		}
+		steps = powerOn(0)
+	case "off":
+		if c.state == Off {
+			return nil
+		}
+		steps = powerOff()
+	case "cycle":
+		steps = append(powerOff(), powerOn(time.Second)...)
+	case "reset":
+		if c.state != On {
+			return fmt.Errorf("host is %s", c.state)
+		}
+		steps = reset()
+	default:
+		return fmt.Errorf("%s: unknown", op)
+	}
+	eventlog.Record(eventlog.Notice, "powerd", "host.power", c.state, op,
+		"host power %s", op)
+	c.steps = steps
+	c.next = time.Now().Add(steps[0].after)
+	// start now so that the state has left on or off by the time the
+	// requester looks
+	return c.sequence()
+}
+
+// sequence does the next step of the operation in progress, if it's due.
+func (c *Command) sequence() error {
+	if len(c.steps) == 0 || time.Now().Before(c.next) {
+		return nil
+	}
+	s := c.steps[0]
+	c.steps = c.steps[1:]
+	if err := s.do(); err != nil {
+		c.steps = nil
+		daemon.StartI2c()
+		c.setState(sense())
+		return err
+	}
+	if s.state != "" {
+		c.setState(s.state)
+	}
+	if len(c.steps) > 0 {
+		c.next = time.Now().Add(c.steps[0].after)
+	}
+	return nil
+}
+
+// follow finishes turning the host off or on when the supplies' enables
+// have been changed other than by an operation.
+func (c *Command) follow() error {
+	if len(c.steps) > 0 || (c.state != On && c.state != Off) {
+		return nil
+	}
+	s := sense()
+	if s == c.state {
+		return nil
+	}
+	eventlog.Record(eventlog.Notice, "powerd", "host.power.state",
+		c.state, s, "host power %s by the supplies' admin.state", s)
+	var steps []step
+	if s == Off {
+		steps = powerOff()
+	} else {
+		// leave the supplies as enabled
+		steps = powerOn(0)[1:]
+		c.setState(PoweringOn)
+	}
+	c.steps = steps
+	c.next = time.Now().Add(steps[0].after)
+	return nil
+}
+
+func setPins(names []string, v bool) func() error {
+	return func() error {
+		for _, name := range names {
+			pin, found := gpio.FindPin(name)
+			if !found {
+				return fmt.Errorf("%s: not found", name)
+			}
+			if err := pin.SetValue(v); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// powerOff stops i2c, as its devices lose power, then disables the
+// supplies.
+func powerOff() []step {
+	return []step{
+		{0, daemon.StopI2c, PoweringOff},
+		{500 * time.Millisecond, setPins(GpioPwronL, true), Off},
+	}
+}
+
+// powerOn enables the supplies then resets the ethernet switch and
+// restarts i2c once power is stable.
+func powerOn(after time.Duration) []step {
+	return []step{
+		{after, setPins(GpioPwronL, false), PoweringOn},
+		{time.Second, setPins([]string{GpioEthxRstL}, false), ""},
+		{50 * time.Millisecond, func() error {
+			if err := setPins([]string{GpioEthxRstL}, true)(); err != nil {
+				return err
+			}
+			return daemon.StartI2c()
+		}, On},
+	}
+}
+
+func reset() []step {
+	return []step{
+		{0, setPins([]string{GpioHostRstL}, false), Resetting},
+		{100 * time.Millisecond, setPins([]string{GpioHostRstL}, true), On},
+	}
+}
+
+func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package powerd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/goes/external/redis"
+)
+
+// StateFile keeps the restore policy and the host's last power state
+// across AC loss; /etc is on /perm.
+var StateFile = "/etc/goes/power.json"
+
+// PowerOffEvents is published by ucd9090d: the times of the power off
+// events in the sequencer's nonvolatile fault log, newest first.
+var PowerOffEvents = "vmon.poweroff.events"
+
+// Policies of host.power.restore_policy, what powerd does with the host
+// when power returns after an AC loss.
+const (
+	AlwaysOn  = "always-on"
+	AlwaysOff = "always-off"
+	LastState = "last-state"
+)
+
+var RestorePolicies = []string{AlwaysOn, AlwaysOff, LastState}
+
+// restoreWait bounds the wait for ucd9090d's fault log at boot.
+const restoreWait = time.Minute
+
+// Settings are what powerd keeps in StateFile.
+type Settings struct {
+	RestorePolicy string
+	// LastState is the host's last settled state, on or off.
+	LastState string
+	// LastPowerOff is the newest power off event seen, which tells an
+	// AC loss from a restart of the bmc alone.
+	LastPowerOff string
+}
+
+// loadSettings returns the saved settings, or the default policy,
+// always-on, which is what the supplies do by themselves.
+func loadSettings() (*Settings, error) {
+	s := &Settings{RestorePolicy: AlwaysOn}
+	b, err := ioutil.ReadFile(StateFile)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(b, s)
+	}
+	if err != nil {
+		return s, fmt.Errorf("%s: %w", StateFile, err)
+	}
+	return s, nil
+}
+
+func (s *Settings) save() error {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := StateFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, StateFile)
+}
+
+// restoreOp returns the operation that policy calls for after an AC loss,
+// or "" if none.
+func restoreOp(policy, last string) string {
+	switch policy {
+	case AlwaysOn:
+		return "on"
+	case AlwaysOff:
+		return "off"
+	case LastState:
+		if last == On || last == Off {
+			return last
+		}
+	}
+	return ""
+}
+
+func (c *Command) setPolicy(policy string) error {
+	if policy == c.settings.RestorePolicy {
+		return nil
+	}
+	eventlog.Record(eventlog.Notice, "powerd", "host.power.restore_policy",
+		c.settings.RestorePolicy, policy, "restore policy %s", policy)
+	c.settings.RestorePolicy = policy
+	return c.settings.save()
+}
+
+// record saves the host's state once it has settled, after the restore
+// policy has been applied.
+func (c *Command) record(state string) {
+	if !c.restored || state != On && state != Off ||
+		state == c.settings.LastState {
+		return
+	}
+	c.settings.LastState = state
+	c.d.Check("save", c.settings.save())
+}
+
+// apply applies the restore policy if power was logged lost or the host
+// came on by itself.
+func (c *Command) apply(logged bool) error {
+	s := c.settings
+	c.restored = true
+	lost := logged || s.LastState == Off && c.sensed != Off
+	op := restoreOp(s.RestorePolicy, s.LastState)
+	if lost && op != "" {
+		eventlog.Record(eventlog.Notice, "powerd",
+			"host.power.restore_policy", "", s.RestorePolicy,
+			"power restored, %s: host power %s",
+			s.RestorePolicy, op)
+		if err := c.request(op); err != nil {
+			return err
+		}
+	}
+	c.record(c.state)
+	return nil
+}
+
+// restore applies the restore policy once, as soon as ucd9090d has read
+// its fault log. Power was lost if the sequencer has logged a power off
+// since the last look, or if the host was off and was on when powerd
+// started. Without the fault log after restoreWait, only the latter is
+// known. Afterwards, restore keeps up with the log so that a power off
+// while the bmc runs isn't taken for an AC loss.
+func (c *Command) restore() error {
+	s := c.settings
+	v, err := redis.Hget(redis.DefaultHash, PowerOffEvents)
+	if err != nil || v == "" {
+		if !c.restored && time.Since(c.started) > restoreWait {
+			log.Print("warning: ", PowerOffEvents,
+				": unavailable, restore policy applied only if ",
+				"the host came on by itself")
+			return c.apply(false)
+		}
+		return nil
+	}
+	newest := strings.SplitN(v, ".", 2)[0]
+	if !c.restored {
+		if err = c.apply(newest != s.LastPowerOff); err != nil {
+			return err
+		}
+	}
+	if newest != s.LastPowerOff {
+		s.LastPowerOff = newest
+		return s.save()
+	}
+	return nil
+}
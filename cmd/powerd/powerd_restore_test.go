@@ -0,0 +1,47 @@
+package powerd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreOp(t *testing.T) {
+	for _, x := range []struct {
+		policy, last, op string
+	}{
+		{AlwaysOn, Off, "on"},
+		{AlwaysOff, On, "off"},
+		{LastState, On, "on"},
+		{LastState, Off, "off"},
+		{LastState, "", ""},
+		{"", On, ""},
+	} {
+		if op := restoreOp(x.policy, x.last); op != x.op {
+			t.Errorf("%s %q: got %q, want %q", x.policy, x.last, op,
+				x.op)
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "powerd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(fn string) { StateFile = fn }(StateFile)
+	StateFile = filepath.Join(dir, "power.json")
+	s, err := loadSettings()
+	if err != nil || s.RestorePolicy != AlwaysOn {
+		t.Fatal(s, err)
+	}
+	s.RestorePolicy, s.LastState = LastState, Off
+	if err = s.save(); err != nil {
+		t.Fatal(err)
+	}
+	if s2, err := loadSettings(); err != nil || *s2 != *s {
+		t.Error(s2, err)
+	}
+}
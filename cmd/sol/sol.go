@@ -0,0 +1,139 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sol
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/platinasystems/flags"
+	"github.com/platinasystems/goes-bmc/cmd/sold"
+	"github.com/platinasystems/goes/lang"
+)
+
+const (
+	ctrlA = 1
+	ctrlX = 0x18
+)
+
+type Command struct{}
+
+func (Command) String() string { return "sol" }
+
+func (Command) Usage() string { return "sol [-r]" }
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "attach to the host console",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	The sol command attaches to the host console through sold, first
+	showing its recent output. Type ^A^X to detach, or ^A^A to send ^A.
+
+	The host's uart reaches sold through the console mux, so the first
+	session sets console.owner to bmc, taking the host console from the
+	front panel port, and the last one to leave gives it back. Sessions
+	are closed if console.owner returns to host while they're attached.
+
+	Only one session at a time may type to the host; others, and those
+	attached with -r, only watch. Only sold's own user may attach.
+
+OPTIONS
+	-r	read-only`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-r")
+	if len(args) > 0 {
+		return fmt.Errorf("%v: unexpected", args)
+	}
+	mode := sold.ReadWrite
+	if flag.ByName["-r"] {
+		mode = sold.ReadOnly
+	}
+
+	conn, err := net.Dial("unix", sold.Socket)
+	if err != nil {
+		return fmt.Errorf("sold: %v", err)
+	}
+	defer conn.Close()
+	if _, err = io.WriteString(conn, mode+"\n"); err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if reply = strings.TrimSpace(reply); reply != sold.OK {
+		return errors.New(reply)
+	}
+
+	saved, err := sold.MakeRaw(uintptr(syscall.Stdin))
+	if err != nil {
+		return err
+	}
+	defer sold.SetTermios(uintptr(syscall.Stdin), saved)
+
+	fmt.Print("Type ^A^X to detach.\r\n")
+	done := make(chan struct{})
+	go func() {
+		io.Copy(os.Stdout, r)
+		close(done)
+	}()
+	go func() {
+		relay(conn, os.Stdin, mode == sold.ReadWrite)
+		conn.Close()
+	}()
+	<-done
+	fmt.Print("\r\n")
+	return nil
+}
+
+// relay copies stdin to the session, if read-write, until ^A^X.
+func relay(w io.Writer, r io.Reader, rw bool) {
+	buf := make([]byte, 4096)
+	escaped := false
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		var out bytes.Buffer
+		for _, c := range buf[:n] {
+			if escaped {
+				escaped = false
+				if c == ctrlX {
+					return
+				}
+				if c != ctrlA {
+					continue
+				}
+			} else if c == ctrlA {
+				escaped = true
+				continue
+			}
+			out.WriteByte(c)
+		}
+		if rw && out.Len() > 0 {
+			if _, err = w.Write(out.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sold
+
+import (
+	"io"
+	"time"
+)
+
+// Ring keeps the last len(b) bytes written.
+type Ring struct {
+	b    []byte
+	next int
+	full bool
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{b: make([]byte, size)}
+}
+
+func (r *Ring) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= len(r.b) {
+		copy(r.b, p[n-len(r.b):])
+		r.next, r.full = 0, true
+		return n, nil
+	}
+	i := copy(r.b[r.next:], p)
+	if i < n {
+		copy(r.b, p[i:])
+		r.full = true
+	}
+	r.next = (r.next + n) % len(r.b)
+	if r.next == 0 {
+		r.full = true
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the contents, oldest first.
+func (r *Ring) Bytes() []byte {
+	if !r.full {
+		return append([]byte(nil), r.b[:r.next]...)
+	}
+	return append(append([]byte(nil), r.b[r.next:]...), r.b[:r.next]...)
+}
+
+// stamper prefixes each line written through it with the time.
+type stamper struct {
+	w   io.Writer
+	now func() time.Time
+	mid bool
+}
+
+const stampFormat = "2006-01-02T15:04:05.000Z07:00 "
+
+func (s *stamper) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if !s.mid {
+			stamp := s.now().Format(stampFormat)
+			if _, err := io.WriteString(s.w, stamp); err != nil {
+				return n, err
+			}
+			s.mid = true
+		}
+		line := p
+		for i, c := range p {
+			if c == '\n' {
+				line = p[:i+1]
+				s.mid = false
+				break
+			}
+		}
+		w, err := s.w.Write(line)
+		n += w
+		if err != nil {
+			return n, err
+		}
+		p = p[len(line):]
+	}
+	return n, nil
+}
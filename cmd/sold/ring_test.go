@@ -0,0 +1,40 @@
+package sold
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(8)
+	for _, x := range []struct {
+		write, want string
+	}{
+		{"abc", "abc"},
+		{"defgh", "abcdefgh"},
+		{"ij", "cdefghij"},
+		{"klmnopqrstu", "nopqrstu"},
+		{"v", "opqrstuv"},
+	} {
+		r.Write([]byte(x.write))
+		if got := string(r.Bytes()); got != x.want {
+			t.Errorf("after %q: got %q, want %q", x.write, got,
+				x.want)
+		}
+	}
+}
+
+func TestStamper(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2020, 5, 6, 7, 8, 9, 0, time.UTC)
+	s := &stamper{w: &buf, now: func() time.Time { return now }}
+	for _, p := range []string{"login", ": \r\nfoo\n", "\nbar"} {
+		s.Write([]byte(p))
+	}
+	ts := "2020-05-06T07:08:09.000Z "
+	want := ts + "login: \r\n" + ts + "foo\n" + ts + "\n" + ts + "bar"
+	if buf.String() != want {
+		t.Errorf("got %q\nwant %q", buf.String(), want)
+	}
+}
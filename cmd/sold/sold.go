@@ -0,0 +1,417 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package sold serves the host console, serial over LAN. It keeps the
+// recent output of the host's uart for sessions that attach, through the
+// sol command, and logs it to the MMC card.
+//
+// The console mux that consoled owns gives the host's uart either to the
+// front panel port or, while console.owner is bmc, to the bmc's Tty. So
+// sold takes the mux for the bmc when the first session attaches and gives
+// it back to the host when the last one leaves, unless the bmc already had
+// it. Sessions are dropped if the mux returns to the host under them, e.g.
+// when consoled's console.return.units.seconds runs out.
+//
+// Only processes of sold's own user may attach.
+package sold
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/consoled"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/mmclogd"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/external/redis/rpc/args"
+	"github.com/platinasystems/goes/external/redis/rpc/reply"
+	"github.com/platinasystems/goes/lang"
+)
+
+var (
+	// Tty is the bmc uart wired to the host console, from the board's
+	// description; without one, sold has nothing to do.
+	Tty  string
+	Baud = uint32(syscall.B115200)
+
+	// Socket is the abstract unix socket that sol attaches to.
+	Socket = "@sol"
+
+	LogFile = mmclogd.MMCDIR + "/sol.log"
+
+	// getOwner and setOwner read and set the console mux through
+	// consoled.
+	getOwner = func() (string, error) {
+		return redis.Hget(redis.DefaultHash, "console.owner")
+	}
+	setOwner = func(owner string) error {
+		_, err := redis.Hset(redis.DefaultHash, "console.owner", owner)
+		return err
+	}
+)
+
+const (
+	RingSize       = 64 * 1024
+	LogMax   int64 = 16 * 1024 * 1024
+
+	// backlog is the number of reads queued for a session before it's
+	// dropped as too slow.
+	backlog = 256
+)
+
+// The first line from sol is the mode, ReadOnly or ReadWrite, and the
+// reply, OK or an error.
+const (
+	ReadOnly  = "ro"
+	ReadWrite = "rw"
+	OK        = "ok"
+)
+
+type Command struct {
+	Info
+	Init func()
+	init sync.Once
+}
+
+type Info struct {
+	mutex    sync.Mutex
+	d        *daemon.Daemon
+	tty      *os.File
+	ring     *Ring
+	sessions map[*session]struct{}
+	writer   *session
+	took     bool
+	log      *os.File
+	logSize  int64
+	stamper  *stamper
+}
+
+type session struct {
+	conn net.Conn
+	out  chan []byte
+}
+
+func (*Command) String() string { return "sold" }
+
+func (*Command) Usage() string { return "sold" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "host serial over LAN daemon",
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(...string) error {
+	if c.Init != nil {
+		c.init.Do(c.Init)
+	}
+
+	c.d = daemon.New("sold")
+	if err := c.d.Start(&c.Info); err != nil {
+		return err
+	}
+
+	if Tty == "" {
+		return c.d.Run()
+	}
+
+	var err error
+	c.tty, err = os.OpenFile(Tty, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return err
+	}
+	defer c.tty.Close()
+	if err = setLine(c.tty.Fd(), Baud); err != nil {
+		return err
+	}
+	l, err := net.Listen("unix", Socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	c.ring = NewRing(RingSize)
+	c.sessions = make(map[*session]struct{})
+	go c.follow()
+	go c.accept(l)
+
+	defer c.closeLog()
+	return c.d.Run(daemon.Ticker{
+		Name:     "update",
+		Interval: time.Second,
+		Func:     c.update,
+	})
+}
+
+// follow copies the host's output to the ring, log and sessions.
+func (c *Info) follow() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.tty.Read(buf)
+		if err != nil {
+			c.d.Check("read", err)
+			return
+		}
+		b := append([]byte(nil), buf[:n]...)
+		c.mutex.Lock()
+		c.ring.Write(b)
+		if c.log != nil {
+			c.logWrite(b)
+		}
+		for s := range c.sessions {
+			select {
+			case s.out <- b:
+			default:
+				// too slow, drop it
+				s.conn.Close()
+			}
+		}
+		c.mutex.Unlock()
+	}
+}
+
+func (c *Info) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go c.serve(conn)
+	}
+}
+
+// serve attaches a session, replays the ring to it, then relays the host's
+// output and, if read-write, its input.
+func (c *Info) serve(conn net.Conn) {
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		io.WriteString(conn, err.Error()+"\n")
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	mode, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	s := &session{conn, make(chan []byte, backlog)}
+	mode = strings.TrimSpace(mode)
+	if err = c.attach(s, mode); err != nil {
+		io.WriteString(conn, err.Error()+"\n")
+		return
+	}
+	defer c.detach(s)
+	go func() {
+		for b := range s.out {
+			if _, err := conn.Write(b); err != nil {
+				conn.Close()
+			}
+		}
+	}()
+	if mode == ReadWrite {
+		io.Copy(c.tty, r)
+	} else {
+		io.Copy(ioutil.Discard, r)
+	}
+}
+
+func (c *Info) attach(s *session, mode string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch mode {
+	case ReadOnly:
+	case ReadWrite:
+		if c.writer != nil {
+			return errors.New("read-write session in use")
+		}
+	default:
+		return errors.New(mode + ": unknown mode")
+	}
+	if err := c.takePort(); err != nil {
+		return err
+	}
+	if mode == ReadWrite {
+		c.writer = s
+	}
+	s.out <- []byte(OK + "\n")
+	if b := c.ring.Bytes(); len(b) > 0 {
+		s.out <- b
+	}
+	c.sessions[s] = struct{}{}
+	return nil
+}
+
+func (c *Info) detach(s *session) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.sessions, s)
+	if c.writer == s {
+		c.writer = nil
+	}
+	close(s.out)
+	c.releasePort()
+}
+
+// checkPeer refuses peers that aren't sold's own user.
+func checkPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.New("not a unix socket")
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred *syscall.Ucred
+	cerr := rc.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd),
+			syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return err
+	}
+	if cred.Uid != uint32(os.Geteuid()) {
+		return errors.New("permission denied")
+	}
+	return nil
+}
+
+// takePort gives the console mux to the bmc for a session, remembering
+// whether sold took it so that releasePort gives it back. The mutex is
+// held.
+func (c *Info) takePort() error {
+	owner, err := getOwner()
+	if err != nil {
+		return err
+	}
+	if owner == consoled.Bmc {
+		return nil
+	}
+	if err = setOwner(consoled.Bmc); err != nil {
+		return err
+	}
+	c.took = true
+	return nil
+}
+
+// releasePort gives the console mux back to the host after the last
+// session if sold took it. The mutex is held.
+func (c *Info) releasePort() {
+	if len(c.sessions) > 0 || !c.took {
+		return
+	}
+	c.took = false
+	c.d.Check("release", setOwner(consoled.Host))
+}
+
+// update follows console.owner, publishes the sessions and opens the log
+// once the MMC card is mounted.
+func (c *Info) update() error {
+	owner, err := getOwner()
+	c.mutex.Lock()
+	var drop []*session
+	if err == nil && owner != consoled.Bmc {
+		// the host's uart went back to the front panel port
+		for s := range c.sessions {
+			drop = append(drop, s)
+		}
+		c.took = false
+	}
+	n := len(c.sessions)
+	rw := c.writer != nil
+	open := c.log != nil
+	c.mutex.Unlock()
+	for _, s := range drop {
+		s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		io.WriteString(s.conn, "\r\nconsole.owner is "+
+			consoled.Host+"; session closed\r\n")
+		s.conn.Close()
+	}
+	c.d.Changed("sol.sessions", strconv.Itoa(n))
+	c.d.Changed("sol.read_write", strconv.FormatBool(rw))
+	if open {
+		return nil
+	}
+	if _, err := os.Stat(mmclogd.ENABLE); err != nil {
+		return nil
+	}
+	return c.openLog()
+}
+
+func (c *Info) openLog() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.reopenLog()
+}
+
+// reopenLog opens LogFile to append. The mutex is held.
+func (c *Info) reopenLog() error {
+	f, err := os.OpenFile(LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND,
+		0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.log, c.logSize = f, fi.Size()
+	c.stamper = &stamper{w: f, now: time.Now}
+	return nil
+}
+
+// logWrite logs b with the time of each line, and when the log reaches
+// LogMax, moves it to LogFile.1. The mutex is held.
+func (c *Info) logWrite(b []byte) {
+	n, err := c.stamper.Write(b)
+	c.logSize += int64(n)
+	if err == nil && c.logSize >= LogMax {
+		c.log.Close()
+		c.log = nil
+		if err = os.Rename(LogFile, LogFile+".1"); err == nil {
+			err = c.reopenLog()
+		}
+	}
+	if err != nil {
+		c.d.Check("log", err)
+		if c.log != nil {
+			c.log.Close()
+			c.log = nil
+		}
+	}
+}
+
+func (c *Info) closeLog() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.log != nil {
+		c.log.Close()
+		c.log = nil
+	}
+}
+
+func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
+	}
+	return err
+}
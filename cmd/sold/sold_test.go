@@ -0,0 +1,110 @@
+package sold
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/consoled"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes/external/redis/publisher"
+)
+
+func TestMux(t *testing.T) {
+	var mutex sync.Mutex
+	owner := consoled.Host
+	var sets []string
+	defer func(get func() (string, error), set func(string) error) {
+		getOwner, setOwner = get, set
+	}(getOwner, setOwner)
+	getOwner = func() (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return owner, nil
+	}
+	setOwner = func(s string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		owner = s
+		sets = append(sets, s)
+		return nil
+	}
+	want := func(s string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if o, _ := getOwner(); o == s {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("console.owner isn't %s", s)
+	}
+
+	l, err := net.Listen("unix", "@sold-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c := &Info{
+		d:        daemon.New("sold"),
+		ring:     NewRing(RingSize),
+		sessions: make(map[*session]struct{}),
+	}
+	c.d.Pub, _ = publisher.New()
+	go c.accept(l)
+
+	attach := func() (net.Conn, *bufio.Reader) {
+		t.Helper()
+		conn, err := net.Dial("unix", "@sold-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(ReadOnly + "\n"))
+		r := bufio.NewReader(conn)
+		if s, err := r.ReadString('\n'); err != nil || s != OK+"\n" {
+			t.Fatalf("attach: %q, %v", s, err)
+		}
+		return conn, r
+	}
+
+	// the first session takes the mux, the last gives it back
+	a, _ := attach()
+	want(consoled.Bmc)
+	b, _ := attach()
+	a.Close()
+	time.Sleep(50 * time.Millisecond)
+	want(consoled.Bmc)
+	b.Close()
+	want(consoled.Host)
+
+	// sessions are dropped when the mux returns to the host
+	a, r := attach()
+	want(consoled.Bmc)
+	setOwner(consoled.Host)
+	if err = c.update(); err != nil {
+		t.Fatal(err)
+	}
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	msg, _ := ioutil.ReadAll(r)
+	if !strings.Contains(string(msg), "session closed") {
+		t.Errorf("dropped session got %q", msg)
+	}
+	a.Close()
+
+	// the mux isn't given back if the bmc already had it
+	setOwner(consoled.Bmc)
+	a, _ = attach()
+	a.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	got := strings.Join(sets, " ")
+	if s := "bmc host bmc host bmc"; got != s {
+		t.Errorf("console.owner set to %q, want %q", got, s)
+	}
+}
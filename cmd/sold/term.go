@@ -0,0 +1,69 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sold
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+func GetTermios(fd uintptr) (*syscall.Termios, error) {
+	t := &syscall.Termios{}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd,
+		uintptr(syscall.TCGETS), uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return nil, fmt.Errorf("TCGETS: %v", errno)
+	}
+	return t, nil
+}
+
+func SetTermios(fd uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd,
+		uintptr(syscall.TCSETS), uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return fmt.Errorf("TCSETS: %v", errno)
+	}
+	return nil
+}
+
+// MakeRaw turns off the line discipline's input and output processing,
+// echo and signals, returning the previous settings.
+func MakeRaw(fd uintptr) (*syscall.Termios, error) {
+	saved, err := GetTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+	t := *saved
+	t.Iflag &^= syscall.IGNBRK |
+		syscall.BRKINT |
+		syscall.PARMRK |
+		syscall.ISTRIP |
+		syscall.INLCR |
+		syscall.IGNCR |
+		syscall.ICRNL |
+		syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO |
+		syscall.ECHONL |
+		syscall.ICANON |
+		syscall.ISIG |
+		syscall.IEXTEN
+	return saved, SetTermios(fd, &t)
+}
+
+// setLine makes the uart raw, 8N1 at baud, ignoring modem control.
+func setLine(fd uintptr, baud uint32) error {
+	if _, err := MakeRaw(fd); err != nil {
+		return err
+	}
+	t, err := GetTermios(fd)
+	if err != nil {
+		return err
+	}
+	t.Cflag = baud | syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+	t.Ispeed, t.Ospeed = baud, baud
+	return SetTermios(fd, t)
+}
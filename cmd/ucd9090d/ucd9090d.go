@@ -8,25 +8,17 @@ package ucd9090d
 import (
 	"fmt"
 	"io/ioutil"
-	"net/rpc"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/platinasystems/atsock"
-	"github.com/platinasystems/goes"
-	"github.com/platinasystems/goes-bmc/cmd/fantrayd"
-	"github.com/platinasystems/goes-bmc/cmd/ledgpiod"
-	"github.com/platinasystems/goes-bmc/cmd/w83795d"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
 	"github.com/platinasystems/goes/cmd"
-	"github.com/platinasystems/goes/external/redis"
-	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/external/redis/rpc/args"
 	"github.com/platinasystems/goes/external/redis/rpc/reply"
 	"github.com/platinasystems/goes/lang"
-	"github.com/platinasystems/gpio"
 	"github.com/platinasystems/log"
 )
 
@@ -35,22 +27,14 @@ var (
 
 	VpageByKey map[string]uint8
 
-	WrRegDv  = make(map[string]string)
-	WrRegFn  = make(map[string]string)
-	WrRegVal = make(map[string]string)
-	WrRegRng = make(map[string][]string)
+	// Rails names the rail of each page, from 0, in the fault log.
+	Rails []string
 
 	loggedFaultCount      uint8
 	lastLoggedFaultDetail [12]byte
 
 	first    int
 	firstLog int
-
-	watchdogEn       bool
-	watchdogTimeout  uint
-	watchdogSequence string
-	watchdogTimer    uint
-	watchdogExpired  bool
 )
 
 type Command struct {
@@ -61,16 +45,17 @@ type Command struct {
 
 type Info struct {
 	mutex sync.Mutex
-	rpc   *atsock.RpcServer
-	pub   *publisher.Publisher
-	last  map[string]float64
-	lasts map[string]string
-	lastu map[string]uint16
+	d     *daemon.Daemon
 }
 
+// I2cDev is the device. If MuxAddr isn't zero, it's behind that mux on
+// MuxBus, which is set to MuxValue before each access.
 type I2cDev struct {
-	Bus  int
-	Addr int
+	Bus      int
+	Addr     int
+	MuxBus   int
+	MuxAddr  int
+	MuxValue int
 }
 
 func (*Command) String() string { return "ucd9090d" }
@@ -86,67 +71,32 @@ func (*Command) Apropos() lang.Alt {
 func (*Command) Kind() cmd.Kind { return cmd.Daemon }
 
 func (c *Command) Main(...string) error {
-	var si syscall.Sysinfo_t
-
 	if c.Init != nil {
 		c.init.Do(c.Init)
 	}
 
-	err := redis.IsReady()
-	if err != nil {
-		return err
-	}
-
 	first = 1
 	firstLog = 1
-	watchdogEn = false
-	watchdogTimer = 0
-	watchdogTimeout = 30
-	watchdogSequence = "0"
-	watchdogExpired = false
-
-	c.last = make(map[string]float64)
-	c.lasts = make(map[string]string)
-	c.lastu = make(map[string]uint16)
-
-	if c.pub, err = publisher.New(); err != nil {
-		return err
-	}
-
-	if err = syscall.Sysinfo(&si); err != nil {
-		return err
-	}
+	watchdogInit()
 
-	if c.rpc, err = atsock.NewRpcServer("ucd9090d"); err != nil {
+	c.d = daemon.New("ucd9090d")
+	if err := c.d.Start(&c.Info); err != nil {
 		return err
 	}
 
-	rpc.Register(&c.Info)
-	for _, v := range WrRegDv {
-		err = redis.Assign(redis.DefaultHash+":"+v+".", "ucd9090d", "Info")
-		if err != nil {
-			return err
-		}
-	}
-
-	t := time.NewTicker(10 * time.Second)
-	tw := time.NewTicker(1 * time.Second)
-	for {
-		select {
-		case <-goes.Stop:
-			return nil
-		case <-t.C:
-			if Vdev.Addr != 0 {
-				if err = c.update(); err != nil {
-					log.Printf("Error from update: %s",
-						err)
+	return c.d.Run(
+		daemon.Ticker{
+			Name:     "update",
+			Interval: 10 * time.Second,
+			Func: func() error {
+				if Vdev.Addr == 0 {
+					return nil
 				}
-			}
-		case <-tw.C:
-			c.updateW()
-		}
-
-	}
+				return c.update()
+			},
+		},
+		daemon.Ticker{Name: "watchdog", Interval: 1 * time.Second, Func: c.updateW},
+	)
 }
 
 func (c *Command) update() error {
@@ -166,87 +116,21 @@ func (c *Command) update() error {
 			if err != nil {
 				return err
 			}
-			if v != c.last[k] {
-				c.pub.Print(k, ": ", v)
-				c.last[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "poweroff.events") {
 			v, err := Vdev.PowerCycles()
 			if err != nil {
 				return err
 			}
-			if (v != "") && (v != c.lasts[k]) {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
+			if v != "" {
+				c.d.Changed(k, v)
 			}
 		}
 	}
 	return nil
 }
 
-func (c *Command) updateW() error {
-
-	if err := writeRegs(); err != nil {
-		return err
-	}
-
-	k := "watchdog.enable"
-	v := strconv.FormatBool(watchdogEn)
-	if v != c.lasts[k] {
-		c.pub.Print(k, ": ", v)
-		c.lasts[k] = v
-	}
-
-	k = "watchdog.timeout.units.seconds"
-	v = strconv.Itoa(int(watchdogTimeout))
-	if v != c.lasts[k] {
-		c.pub.Print(k, ": ", v)
-		c.lasts[k] = v
-	}
-
-	k = "watchdog.timer.units.seconds"
-	v = strconv.Itoa(int(watchdogTimer))
-	if v != c.lasts[k] {
-		c.pub.Print(k, ": ", v)
-		c.lasts[k] = v
-	}
-
-	k = "watchdog.sequence"
-	v = watchdogSequence
-	if v != c.lasts[k] {
-		c.pub.Print(k, ": ", v)
-		c.lasts[k] = v
-	}
-
-	k = "watchdog.expired"
-	v = strconv.FormatBool(watchdogExpired)
-	if v != c.lasts[k] {
-		c.pub.Print(k, ": ", v)
-		c.lasts[k] = v
-	}
-
-	if watchdogEn {
-		if watchdogTimer < watchdogTimeout {
-			watchdogTimer++
-		}
-		if watchdogTimer >= watchdogTimeout {
-			log.Print("warning: host watchdog timer expired; reset host; disable watchdog")
-			watchdogExpired = true
-			pin, found := gpio.FindPin("BMC_TO_HOST_RST_L")
-			if found {
-				pin.SetValue(false)
-				time.Sleep(100 * time.Millisecond)
-				pin.SetValue(true)
-				watchdogEn = false
-				watchdogTimer = 0
-			}
-		}
-	}
-
-	return nil
-}
-
 func (h *I2cDev) ucdInit() error {
 	//FIXME configure UCD run time clock, pending ntp
 	return nil
@@ -317,33 +201,21 @@ func (h *I2cDev) PowerCycles() (string, error) {
 				return "", nil
 			}
 			if firstLog == 0 {
-				log.Printf("warning: power event detected")
-				time.Sleep(5 * time.Second)
-
-				log.Print("notice: re-init fan controller")
-				w83795d.Vdev.Bus = 11
-				w83795d.Vdev.Addr = 0x2f
-				w83795d.Vdev.FanInit()
-
-				log.Print("notice: re-init fan trays")
-				fantrayd.Vdev.Bus = 1
-				fantrayd.Vdev.Addr = 0x20
-				fantrayd.Vdev.MuxBus = 1
-				fantrayd.Vdev.MuxAddr = 0x72
-				fantrayd.Vdev.MuxValue = 0x04
-				fantrayd.Vdev.FanTrayLedReinit()
-
-				log.Print("notice: re-init front panel LEDs")
-				ver := 0
-				s, _ := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
-				_, _ = fmt.Sscan(s, &ver)
-				if ver == 0 || ver == 0xff {
-					ledgpiod.Vdev.Addr = 0x22
-				} else {
-					ledgpiod.Vdev.Addr = 0x75
-				}
-				ledgpiod.Vdev.Bus = 5
-				ledgpiod.Vdev.LedFpReinit()
+				_, rail, fault := decodeFault(s[0].D[:])
+				eventlog.Record(eventlog.Warning, "ucd9090d",
+					"vmon.poweroff.events", "", rail+"."+fault,
+					"power event detected, %s %s", rail, fault)
+				// let the rails settle before the other
+				// daemons re-initialize their devices
+				event := rail + "." + fault
+				time.AfterFunc(5*time.Second, func() {
+					err := daemon.Notify(daemon.PowerEvent,
+						"fault", event)
+					if err != nil {
+						log.Print("warning: ",
+							daemon.PowerEvent, ": ", err)
+					}
+				})
 			}
 		}
 		milli = uint32(s[0].D[5]) + uint32(s[0].D[4])<<8 + uint32(s[0].D[3])<<16 + uint32(s[0].D[2])<<24
@@ -371,13 +243,6 @@ func (h *I2cDev) LoggedFaultDetail() (string, error) {
 
 	d := s[0].D[1]
 
-	var milli uint32
-	var page uint8
-	var seconds uint32
-	var faultType uint8
-	var paged uint8
-	var rail string
-	var fault string
 	var log string
 
 	for i := 0; i < int(d); i++ {
@@ -411,179 +276,77 @@ func (h *I2cDev) LoggedFaultDetail() (string, error) {
 				return "", nil
 			}
 		}
-		milli = uint32(s[0].D[5]) + uint32(s[0].D[4])<<8 + uint32(s[0].D[3])<<16 + uint32(s[0].D[2])<<24
-		seconds = milli / 1000
-		timestamp := time.Unix(int64(seconds), 0).Format(time.RFC3339)
-
-		faultType = (s[0].D[6] >> 3) & 0xF
-		paged = s[0].D[6] & 0x80 >> 7
-		page = ((s[0].D[7] & 0x80) >> 7) + ((s[0].D[6] & 0x7) << 1)
-
-		if paged == 1 {
-			switch page {
-			case 0:
-				rail = "P5V_SB"
-			case 1:
-				rail = "P3V8_BMC"
-			case 2:
-				rail = "P3V3_SB"
-			case 3:
-				rail = "PERI_3V3"
-			case 4:
-				rail = "P3V3"
-			case 5:
-				rail = "VDD_CORE"
-			case 6:
-				rail = "P1V8"
-			case 7:
-				rail = "P1V25"
-			case 8:
-				rail = "P1V2"
-			case 9:
-				rail = "P1V0"
-			default:
-				rail = "n/a"
-			}
-			switch faultType {
-			case 0:
-				fault = "VOUT_OV"
-			case 1:
-				fault = "VOUT_UV"
-			case 2:
-				fault = "TON_MAX"
-			case 3:
-				fault = "IOUT_OC"
-			case 4:
-				fault = "IOUT_UC"
-			case 5:
-				fault = "TEMPERATURE_OT"
-			case 6:
-				fault = "SEQUENCE ON TIMEOUT"
-			case 7:
-				fault = "SEQUENCE OFF TIMEOUT"
-			default:
-				fault = "unknown"
-			}
-		} else {
-			rail = "n/a"
-			switch faultType {
-			case 1:
-				fault = "SYSTEM WATCHDOG TIMEOUT"
-			case 2:
-				fault = "RESEQUENCE ERROR"
-			case 3:
-				fault = "WATCHDOG TIMEOUT"
-			case 8:
-				fault = "FAN FAULT"
-			case 9:
-				fault = "GPI FAULT"
-			default:
-				fault = "unknown"
-			}
-
-		}
+		timestamp, rail, fault := decodeFault(s[0].D[:])
 		log += timestamp + "." + rail + "." + fault + "\n"
 	}
 	return log, nil
 }
 
-func writeRegs() error {
-	for k, v := range WrRegVal {
-		switch WrRegFn[k] {
-		case "speed":
-			if false {
-				log.Print("test", k, v)
-			}
-		case "watchdog.enable":
-			enable, err := strconv.ParseBool(v)
-			if err == nil {
-				if !enable {
-					watchdogTimer = 0
-				} else {
-					watchdogExpired = false
-				}
-				watchdogEn = enable
-			}
-		case "watchdog.sequence":
-			watchdogTimer = 0
-			if watchdogEn {
-				watchdogSequence = v
-			} else {
-				k = "watchdog.sequence"
-				pub, err := publisher.New()
-				if err == nil {
-					pub.Print(k, ": ", watchdogSequence)
-				}
-			}
-		case "watchdog.timeout.units.seconds":
-			i, err := strconv.ParseInt(v, 10, 64)
-			if err == nil {
-				watchdogTimeout = uint(i)
-			}
-		}
-		delete(WrRegVal, k)
-	}
-	return nil
-}
-
-func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
-	_, p := WrRegFn[args.Field]
-	if !p {
-		return fmt.Errorf("cannot hset: %s", args.Field)
-	}
-	_, q := WrRegRng[args.Field]
-	if !q {
-		err := i.set(args.Field, string(args.Value), false)
-		if err == nil {
-			*reply = 1
-			WrRegVal[args.Field] = string(args.Value)
+// decodeFault returns the time, rail and fault type of a LoggedFaultDetail
+// entry.
+func decodeFault(d []byte) (timestamp, rail, fault string) {
+	milli := uint32(d[5]) + uint32(d[4])<<8 + uint32(d[3])<<16 + uint32(d[2])<<24
+	seconds := milli / 1000
+	timestamp = time.Unix(int64(seconds), 0).Format(time.RFC3339)
+
+	faultType := (d[6] >> 3) & 0xF
+	paged := d[6] & 0x80 >> 7
+	page := ((d[7] & 0x80) >> 7) + ((d[6] & 0x7) << 1)
+
+	if paged == 1 {
+		rail = "n/a"
+		if int(page) < len(Rails) && Rails[page] != "" {
+			rail = Rails[page]
 		}
-		return err
-	}
-	var a [2]int
-	var e [2]error
-	if len(WrRegRng[args.Field]) == 2 {
-		for i, v := range WrRegRng[args.Field] {
-			a[i], e[i] = strconv.Atoi(v)
-		}
-		if e[0] == nil && e[1] == nil {
-			val, err := strconv.Atoi(string(args.Value))
-			if err != nil {
-				return err
-			}
-			if val >= a[0] && val <= a[1] {
-				err := i.set(args.Field,
-					string(args.Value), false)
-				if err == nil {
-					*reply = 1
-					WrRegVal[args.Field] =
-						string(args.Value)
-				}
-				return err
-			}
-			return fmt.Errorf("Cannot hset.  Valid range is: %s",
-				WrRegRng[args.Field])
+		switch faultType {
+		case 0:
+			fault = "VOUT_OV"
+		case 1:
+			fault = "VOUT_UV"
+		case 2:
+			fault = "TON_MAX"
+		case 3:
+			fault = "IOUT_OC"
+		case 4:
+			fault = "IOUT_UC"
+		case 5:
+			fault = "TEMPERATURE_OT"
+		case 6:
+			fault = "SEQUENCE ON TIMEOUT"
+		case 7:
+			fault = "SEQUENCE OFF TIMEOUT"
+		default:
+			fault = "unknown"
 		}
-	}
-	for _, v := range WrRegRng[args.Field] {
-		if v == string(args.Value) {
-			err := i.set(args.Field, string(args.Value), false)
-			if err == nil {
-				*reply = 1
-				WrRegVal[args.Field] = string(args.Value)
-			}
-			return err
+	} else {
+		rail = "n/a"
+		switch faultType {
+		case 1:
+			fault = "SYSTEM WATCHDOG TIMEOUT"
+		case 2:
+			fault = "RESEQUENCE ERROR"
+		case 3:
+			fault = "WATCHDOG TIMEOUT"
+		case 8:
+			fault = "FAN FAULT"
+		case 9:
+			fault = "GPI FAULT"
+		default:
+			fault = "unknown"
 		}
+
 	}
-	return fmt.Errorf("Cannot hset.  Valid values are: %s",
-		WrRegRng[args.Field])
+	return
 }
 
-func (i *Info) set(key, value string, isReadyEvent bool) error {
-	i.pub.Print(key, ": ", value)
-	return nil
+func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
+	err := i.d.Hset(args.Field, string(args.Value))
+	if err == nil {
+		*reply = 1
+	}
+	return err
 }
 
 func (i *Info) publish(key string, value interface{}) {
-	i.pub.Print(key, ": ", value)
+	i.d.Publish(key, value)
 }
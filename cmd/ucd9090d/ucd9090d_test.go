@@ -0,0 +1,96 @@
+package ucd9090d
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+)
+
+func TestDecodeFault(t *testing.T) {
+	defer func(r []string) { Rails = r }(Rails)
+	Rails = []string{"P5V_SB", "P3V8_BMC", "P3V3_SB", "PERI_3V3"}
+
+	// VOUT_UV of page 3
+	d := []byte{0, 0, 0, 0, 0x03, 0xe8, 0x89, 0x80}
+	for _, x := range []struct {
+		rails []string
+		want  string
+	}{
+		{Rails, "PERI_3V3"},
+		{nil, "n/a"},
+	} {
+		Rails = x.rails
+		ts, rail, fault := decodeFault(d)
+		if rail != x.want || fault != "VOUT_UV" {
+			t.Errorf("got %s %s %s, want %s VOUT_UV", ts, rail,
+				fault, x.want)
+		}
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ucd9090d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(a, b string) { eventlog.LOGA, eventlog.LOGB = a, b }(
+		eventlog.LOGA, eventlog.LOGB)
+	eventlog.LOGA = filepath.Join(dir, "events.log")
+	eventlog.LOGB = filepath.Join(dir, "events.log.1")
+	defer watchdogInit()
+
+	watchdogInit()
+	if !watchdogRearm {
+		t.Error("watchdog doesn't re-arm by default")
+	}
+	for _, x := range []struct {
+		name                string
+		timer, timeout, pre uint
+		rearm               bool
+		ticks               int
+		kick                bool
+		en, preFired, exp   bool
+		expirations         uint
+	}{
+		{"counting", 0, 3, 1, false, 1, false, true, false, false, 0},
+		{"pretimeout", 0, 3, 1, false, 2, false, true, true, false, 0},
+		{"expiry disables", 0, 3, 1, false, 3, false, false, true, true, 1},
+		{"expiry waits", 0, 3, 1, true, 5, false, true, true, true, 1},
+		{"re-armed", 0, 3, 1, true, 3, true, true, false, false, 1},
+		{"disabled kick", 0, 3, 1, false, 3, true, false, false, true, 1},
+		{"timeout lowered", 10, 3, 1, false, 1, false, false, true, true, 1},
+	} {
+		watchdogInit()
+		watchdogEn = true
+		watchdogTimer = x.timer
+		watchdogTimeout = x.timeout
+		watchdogPretimeout = x.pre
+		watchdogAction = "none"
+		watchdogRearm = x.rearm
+		for i := 0; i < x.ticks; i++ {
+			if err = watchdogTick(); err != nil {
+				t.Fatal(x.name, err)
+			}
+		}
+		if x.kick {
+			watchdogKick("7")
+		}
+		if watchdogEn != x.en || watchdogPreFired != x.preFired ||
+			watchdogExpired != x.exp ||
+			watchdogExpirations != x.expirations {
+			t.Errorf("%s: enable %v prefired %v expired %v "+
+				"expirations %d", x.name, watchdogEn,
+				watchdogPreFired, watchdogExpired,
+				watchdogExpirations)
+		}
+		kicked := watchdogSequence == "7"
+		if x.kick && (watchdogTimer != 0 || kicked != x.en) {
+			t.Errorf("%s: timer %d sequence %q", x.name,
+				watchdogTimer, watchdogSequence)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ucd9090d
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/goes-bmc/cmd/powerd"
+	"github.com/platinasystems/gpio"
+)
+
+// The host watchdog counts the seconds since the host last wrote
+// watchdog.sequence. Pretimeout seconds before the timeout it takes the
+// pretimeout action, and at the timeout, the action. An expired watchdog
+// then waits for the host to come back and write watchdog.sequence again,
+// which re-arms it; if watchdog.rearm is false, it disables itself instead.
+
+// Actions are the values of watchdog.action.
+var Actions = []string{"none", "nmi", "interrupt", "reset", "cycle"}
+
+// PretimeoutActions are the values of watchdog.pretimeout.action.
+var PretimeoutActions = []string{"none", "nmi", "interrupt"}
+
+var (
+	// GpioHostNmiL and GpioHostIntL interrupt the host.
+	GpioHostNmiL = "BMC_TO_HOST_NMI_L"
+	GpioHostIntL = "BMC_TO_HOST_INT_L"
+)
+
+// pulseWidth is how long the host's interrupts are asserted.
+const pulseWidth = 100 * time.Millisecond
+
+var (
+	watchdogEn          bool
+	watchdogTimeout     uint
+	watchdogSequence    string
+	watchdogTimer       uint
+	watchdogExpired     bool
+	watchdogAction      string
+	watchdogPretimeout  uint
+	watchdogPreAction   string
+	watchdogPreFired    bool
+	watchdogRearm       bool
+	watchdogExpirations uint
+)
+
+func init() {
+	daemon.Writable("ucd9090d",
+		daemon.Key{
+			Name: "watchdog.enable",
+			Type: daemon.BoolKey,
+			Set: func(v interface{}) error {
+				watchdogEn = v.(bool)
+				watchdogPreFired = false
+				if watchdogEn {
+					watchdogExpired = false
+				} else {
+					watchdogTimer = 0
+				}
+				return nil
+			},
+		},
+		daemon.Key{
+			Name: "watchdog.sequence",
+			Type: daemon.TextKey,
+			Set: func(v interface{}) error {
+				watchdogKick(v.(string))
+				return nil
+			},
+		},
+		daemon.Key{
+			Name: "watchdog.timeout.units.seconds",
+			Type: daemon.IntKey,
+			Min:  1,
+			Max:  3600,
+			Set: func(v interface{}) error {
+				t := uint(v.(int64))
+				if watchdogPretimeout >= t && watchdogPretimeout > 0 {
+					return fmt.Errorf("pretimeout %d >= %d",
+						watchdogPretimeout, t)
+				}
+				watchdogTimeout = t
+				return nil
+			},
+		},
+		daemon.Key{
+			Name:   "watchdog.action",
+			Type:   daemon.EnumKey,
+			Values: Actions,
+			Set: func(v interface{}) error {
+				watchdogAction = v.(string)
+				return nil
+			},
+		},
+		daemon.Key{
+			Name: "watchdog.pretimeout.units.seconds",
+			Type: daemon.IntKey,
+			Max:  3600,
+			Set: func(v interface{}) error {
+				t := uint(v.(int64))
+				if t >= watchdogTimeout && t > 0 {
+					return fmt.Errorf("%d >= timeout %d", t,
+						watchdogTimeout)
+				}
+				watchdogPretimeout = t
+				return nil
+			},
+		},
+		daemon.Key{
+			Name:   "watchdog.pretimeout.action",
+			Type:   daemon.EnumKey,
+			Values: PretimeoutActions,
+			Set: func(v interface{}) error {
+				watchdogPreAction = v.(string)
+				return nil
+			},
+		},
+		daemon.Key{
+			Name: "watchdog.rearm",
+			Type: daemon.BoolKey,
+			Set: func(v interface{}) error {
+				watchdogRearm = v.(bool)
+				return nil
+			},
+		},
+	)
+}
+
+func watchdogInit() {
+	watchdogEn = false
+	watchdogTimer = 0
+	watchdogTimeout = 30
+	watchdogSequence = "0"
+	watchdogExpired = false
+	watchdogAction = "reset"
+	watchdogPretimeout = 0
+	watchdogPreAction = "none"
+	watchdogPreFired = false
+	watchdogRearm = true
+	watchdogExpirations = 0
+}
+
+// watchdogKick restarts the timer. If the watchdog is enabled, it records
+// the host's sequence and re-arms an expired watchdog; if not, the write is
+// quietly accepted.
+func watchdogKick(seq string) {
+	watchdogTimer = 0
+	watchdogPreFired = false
+	if !watchdogEn {
+		return
+	}
+	if watchdogExpired {
+		watchdogExpired = false
+		eventlog.Record(eventlog.Notice, "ucd9090d",
+			"watchdog.expired", "true", "false",
+			"host watchdog re-armed")
+	}
+	watchdogSequence = seq
+}
+
+func (c *Command) updateW() error {
+	c.d.Changed("watchdog.enable", strconv.FormatBool(watchdogEn))
+	c.d.Changed("watchdog.timeout.units.seconds",
+		strconv.Itoa(int(watchdogTimeout)))
+	c.d.Changed("watchdog.timer.units.seconds",
+		strconv.Itoa(int(watchdogTimer)))
+	c.d.Changed("watchdog.sequence", watchdogSequence)
+	c.d.Changed("watchdog.expired", strconv.FormatBool(watchdogExpired))
+	c.d.Changed("watchdog.action", watchdogAction)
+	c.d.Changed("watchdog.pretimeout.units.seconds",
+		strconv.Itoa(int(watchdogPretimeout)))
+	c.d.Changed("watchdog.pretimeout.action", watchdogPreAction)
+	c.d.Changed("watchdog.rearm", strconv.FormatBool(watchdogRearm))
+	c.d.Changed("watchdog.expirations",
+		strconv.Itoa(int(watchdogExpirations)))
+	return watchdogTick()
+}
+
+// watchdogTick counts a second of the enabled watchdog, taking the
+// pretimeout action and, at the timeout, the action.
+func watchdogTick() error {
+	if !watchdogEn || watchdogExpired {
+		return nil
+	}
+	if watchdogTimer < watchdogTimeout {
+		watchdogTimer++
+	}
+	// the timeout may have been lowered below the timer
+	var left uint
+	if watchdogTimer < watchdogTimeout {
+		left = watchdogTimeout - watchdogTimer
+	}
+	if watchdogPretimeout > 0 && left <= watchdogPretimeout &&
+		!watchdogPreFired {
+		watchdogPreFired = true
+		eventlog.Record(eventlog.Warning, "ucd9090d",
+			"watchdog.pretimeout", "", watchdogPreAction,
+			"host watchdog pretimeout, %d seconds left; %s", left,
+			watchdogPreAction)
+		if err := watchdogDo(watchdogPreAction); err != nil {
+			return err
+		}
+	}
+	if watchdogTimer >= watchdogTimeout {
+		watchdogExpired = true
+		watchdogExpirations++
+		watchdogTimer = 0
+		if !watchdogRearm {
+			watchdogEn = false
+		}
+		eventlog.Record(eventlog.Warning, "ucd9090d",
+			"watchdog.expired", "false", "true",
+			"host watchdog timer expired; %s", watchdogAction)
+		return watchdogDo(watchdogAction)
+	}
+	return nil
+}
+
+// watchdogDo takes a watchdog action.
+func watchdogDo(action string) error {
+	switch action {
+	case "nmi":
+		return pulse(GpioHostNmiL)
+	case "interrupt":
+		return pulse(GpioHostIntL)
+	case "reset":
+		return powerd.Request("reset")
+	case "cycle":
+		return powerd.Request("cycle")
+	}
+	return nil
+}
+
+// pulse asserts an active low gpio for pulseWidth.
+func pulse(name string) error {
+	pin, found := gpio.FindPin(name)
+	if !found {
+		return fmt.Errorf("%s: not found", name)
+	}
+	if err := pin.SetValue(false); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	time.Sleep(pulseWidth)
+	return pin.SetValue(true)
+}
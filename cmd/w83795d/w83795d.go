@@ -6,25 +6,21 @@
 package w83795d
 
 import (
-	"errors"
 	"fmt"
-	"net/rpc"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes-bmc/cmd/daemon"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
+	"github.com/platinasystems/goes-bmc/cmd/powerd"
 	"github.com/platinasystems/goes/cmd"
-	"github.com/platinasystems/goes/external/atsock"
 	"github.com/platinasystems/goes/external/log"
 	"github.com/platinasystems/goes/external/redis"
-	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/external/redis/rpc/args"
 	"github.com/platinasystems/goes/external/redis/rpc/reply"
 	"github.com/platinasystems/goes/lang"
-	"github.com/platinasystems/gpio"
 )
 
 var (
@@ -36,8 +32,17 @@ var (
 	qsfpTempTarget uint8 = 60
 	hwmTarget      uint8
 
+	// The host's temperatures are stale, and the fans run high, if it
+	// has reported them but not within hostTempTimeout seconds.
+	hostTempTime    time.Time
+	hostTempTimeout uint = 90
+	hostTempStale   bool
+
 	configuredSpeed string
 
+	// fanFailure is whether a faulted fan tray holds the speed at high.
+	fanFailure bool
+
 	hostCtrl           bool
 	dutyAtThermalEvent int
 	dutyIncrement      int
@@ -49,13 +54,10 @@ var (
 
 	setSpeed     bool
 	setHwmTarget bool
-	hostReset    bool
 
 	Vdev I2cDev
 
 	VpageByKey map[string]uint8
-
-	WrRegDv = make(map[string]string)
 )
 
 type Command struct {
@@ -66,15 +68,109 @@ type Command struct {
 
 type Info struct {
 	mutex sync.Mutex
-	rpc   *atsock.RpcServer
-	pub   *publisher.Publisher
-	last  map[string]uint16
-	lasts map[string]string
+	d     *daemon.Daemon
 }
 
+func init() {
+	temp := func(p *uint8) func(interface{}) error {
+		return func(v interface{}) error {
+			*p = uint8(v.(float64))
+			return nil
+		}
+	}
+	reported := func(p *uint8) func(interface{}) error {
+		set := temp(p)
+		return func(v interface{}) error {
+			hostTempTime = time.Now()
+			return set(v)
+		}
+	}
+	daemon.Writable("w83795d",
+		daemon.Key{
+			Name:   "fan_tray.speed",
+			Type:   daemon.EnumKey,
+			Values: []string{"auto", "high", "med", "low", "max"},
+			Set: func(v interface{}) error {
+				configuredSpeed = v.(string)
+				setSpeed = true
+				return nil
+			},
+		},
+		daemon.Key{
+			Name: "fan_tray.speed.return",
+			Type: daemon.TextKey,
+			Set: func(v interface{}) error {
+				if v.(string) == "" {
+					setSpeed = true
+				}
+				return nil
+			},
+		},
+		daemon.Key{
+			Name: "host.temp.units.C",
+			Type: daemon.FloatKey,
+			Max:  255,
+			Set:  reported(&hostTemp),
+		},
+		daemon.Key{
+			Name: "host.temp.target.units.C",
+			Type: daemon.FloatKey,
+			Min:  25,
+			Max:  85,
+			Set:  temp(&hostTempTarget),
+		},
+		daemon.Key{
+			Name: "qsfp.temp.units.C",
+			Type: daemon.FloatKey,
+			Max:  255,
+			Set:  reported(&qsfpTemp),
+		},
+		daemon.Key{
+			Name: "qsfp.temp.target.units.C",
+			Type: daemon.FloatKey,
+			Min:  25,
+			Max:  85,
+			Set:  temp(&qsfpTempTarget),
+		},
+		daemon.Key{
+			Name: "host.temp.timeout.units.seconds",
+			Type: daemon.IntKey,
+			Max:  3600,
+			Set: func(v interface{}) error {
+				hostTempTimeout = uint(v.(int64))
+				return nil
+			},
+		},
+		daemon.Key{
+			Name: "hwmon.target.units.C",
+			Type: daemon.FloatKey,
+			Min:  25,
+			Max:  60,
+			Set: func(v interface{}) error {
+				hwmTarget = uint8(v.(float64))
+				setHwmTarget = true
+				return nil
+			},
+		},
+		daemon.Key{
+			Name:   "host.reset",
+			Type:   daemon.EnumKey,
+			Values: []string{"true"},
+			Set: func(interface{}) error {
+				return doHostReset()
+			},
+		},
+	)
+}
+
+// I2cDev is the device. If MuxAddr isn't zero, it's behind that mux on
+// MuxBus, which is set to MuxValue before each access.
 type I2cDev struct {
-	Bus  int
-	Addr int
+	Bus      int
+	Addr     int
+	MuxBus   int
+	MuxAddr  int
+	MuxValue int
 }
 
 func (*Command) String() string { return "w83795d" }
@@ -90,52 +186,37 @@ func (*Command) Apropos() lang.Alt {
 func (*Command) Kind() cmd.Kind { return cmd.Daemon }
 
 func (c *Command) Main(...string) error {
-	var si syscall.Sysinfo_t
-
 	if c.Init != nil {
 		c.init.Do(c.Init)
 	}
 
-	err := redis.IsReady()
-	if err != nil {
-		return err
-	}
-
-	c.last = make(map[string]uint16)
-	c.lasts = make(map[string]string)
-
-	if c.pub, err = publisher.New(); err != nil {
+	c.d = daemon.New("w83795d")
+	if err := c.d.Start(&c.Info); err != nil {
 		return err
 	}
 
-	if err = syscall.Sysinfo(&si); err != nil {
-		return err
+	if Vdev.Addr != 0 {
+		Vdev.FanInit()
 	}
 
-	if c.rpc, err = atsock.NewRpcServer("w83795d"); err != nil {
-		return err
-	}
-
-	rpc.Register(&c.Info)
-	for _, v := range WrRegDv {
-		err = redis.Assign(redis.DefaultHash+":"+v+".", "w83795d", "Info")
-		if err != nil {
-			return err
-		}
-	}
-
-	Vdev.FanInit()
-
-	t := time.NewTicker(pollInterval * time.Second)
-	for {
-		select {
-		case <-goes.Stop:
+	c.d.On(daemon.PowerEvent, func(string) error {
+		if Vdev.Addr == 0 {
 			return nil
-		case <-t.C:
-			if err = c.update(); err != nil {
-			}
 		}
-	}
+		log.Print("notice: re-init fan controller")
+		return Vdev.FanInit()
+	})
+
+	return c.d.Run(daemon.Ticker{
+		Name:     "update",
+		Interval: pollInterval * time.Second,
+		Func: func() error {
+			if Vdev.Addr == 0 {
+				return nil
+			}
+			return c.update()
+		},
+	})
 }
 
 func (c *Command) update() error {
@@ -157,10 +238,7 @@ func (c *Command) update() error {
 		setHwmTarget = false
 	}
 
-	if hostReset {
-		doHostReset()
-		hostReset = false
-	}
+	c.checkStale()
 
 	if err := Vdev.PollThermal(); err != nil {
 		log.Print("PollThermal: Err: ", err)
@@ -171,20 +249,14 @@ func (c *Command) update() error {
 			if err != nil {
 				continue
 			}
-			if v != c.last[k] {
-				c.pub.Print(k, ": ", v)
-				c.last[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "fan_tray.speed") {
 			v := configuredSpeed
 			if hostCtrl {
 				v = "thermal_override"
 			}
-			if v != c.lasts[k] {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "fan_tray.duty") {
 			v, err := Vdev.GetFanDuty()
@@ -192,73 +264,72 @@ func (c *Command) update() error {
 			if err != nil {
 				return err
 			}
-			if sv != c.lasts[k] {
-				c.pub.Print(k, ": ", sv)
-				c.lasts[k] = sv
-			}
+			c.d.Changed(k, sv)
 		}
 		if strings.Contains(k, "hwmon.front.temp.units.C") {
 			v, err := Vdev.FrontTemp()
 			if err != nil {
 				return err
 			}
-			if v != c.lasts[k] {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "hwmon.rear.temp.units.C") {
 			v, err := Vdev.RearTemp()
 			if err != nil {
 				return err
 			}
-			if v != c.lasts[k] {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "host.temp.units.C") {
 			v := Vdev.CheckHostTemp()
-			if v != c.lasts[k] {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "host.temp.target.units.C") {
 			v := Vdev.GetHostTempTarget()
-			if v != c.lasts[k] {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "qsfp.temp.units.C") {
 			v := Vdev.CheckQsfpTemp()
-			if v != c.lasts[k] {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "qsfp.temp.target.units.C") {
 			v := Vdev.GetQsfpTempTarget()
-			if v != c.lasts[k] {
-				c.pub.Print(k, ": ", v)
-				c.lasts[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 		if strings.Contains(k, "hwmon.target.units.C") {
 			v, err := Vdev.GetHwmTarget()
 			if err != nil {
 				return err
 			}
-			if v != c.last[k] {
-				c.pub.Print(k, ": ", v)
-				c.last[k] = v
-			}
+			c.d.Changed(k, v)
 		}
 	}
 	return nil
 }
 
+// checkStale runs the fans high while the host's temperatures are stale.
+func (c *Command) checkStale() {
+	stale := hostTempTimeout > 0 && !hostTempTime.IsZero() &&
+		time.Since(hostTempTime) >
+			time.Duration(hostTempTimeout)*time.Second
+	if stale != hostTempStale {
+		hostTempStale = stale
+		if stale {
+			eventlog.Record(eventlog.Warning, "w83795d",
+				"host.temp.stale", "false", "true",
+				"host temperatures stale; fans high")
+		} else {
+			eventlog.Record(eventlog.Notice, "w83795d",
+				"host.temp.stale", "true", "false",
+				"host temperatures resumed")
+		}
+		Vdev.SetConfiguredSpeed()
+	}
+	c.d.Changed("host.temp.stale", strconv.FormatBool(hostTempStale))
+	c.d.Changed("host.temp.timeout.units.seconds",
+		strconv.Itoa(int(hostTempTimeout)))
+}
+
 const (
 	fanPoles    = 4
 	tempCtrl2   = 0x5f
@@ -407,9 +478,13 @@ func (h *I2cDev) FanInit() error {
 }
 
 func (h *I2cDev) SetConfiguredSpeed() error {
+	speed := configuredSpeed
+	if hostTempStale {
+		speed = "high"
+	}
 	current, _ := h.GetFanSpeed()
-	if current != configuredSpeed {
-		h.SetFanSpeed(configuredSpeed)
+	if current != speed {
+		h.SetFanSpeed(speed)
 	}
 	return nil
 }
@@ -440,14 +515,27 @@ func (h *I2cDev) SetFanSpeed(w string) error {
 	r2 := getRegsBank2()
 
 	//if not all fan trays are ok, only allow high setting
+	failure := false
 	for j := 1; j <= maxFanTrays; j++ {
 		p, _ := redis.Hget(redis.DefaultHash, "fan_tray."+strconv.Itoa(int(j))+".status")
 		if p != "" && !strings.Contains(p, "ok") {
-			log.Print("warning: fan failure mode, speed fixed at high")
-			w = "high"
+			failure = true
 			break
 		}
 	}
+	if failure && !fanFailure {
+		eventlog.Record(eventlog.Warning, "w83795d",
+			"fan_tray.speed", w, "high",
+			"fan failure mode, speed fixed at high")
+	} else if !failure && fanFailure {
+		eventlog.Record(eventlog.Notice, "w83795d",
+			"fan_tray.speed", "high", w,
+			"fan failure mode cleared, speed %s", w)
+	}
+	fanFailure = failure
+	if failure {
+		w = "high"
+	}
 
 	switch w {
 	case "auto":
@@ -674,111 +762,17 @@ func (h *I2cDev) GetQsfpTempTarget() string {
 }
 
 func doHostReset() error {
-	// FIXME cmd.Init("gpio")
-	log.Print("notice: issue hard reset to host")
-	pin, found := gpio.FindPin("BMC_TO_HOST_RST_L")
-	if found {
-		pin.SetValue(false)
-	}
-	time.Sleep(50 * time.Millisecond)
-	if found {
-		pin.SetValue(true)
-	}
-	return nil
-}
-
-func parseTemp(t string, low uint8, high uint8) (uint8, error) {
-	f, err := strconv.ParseFloat(t, 64)
-	if err != nil {
-		return high, err
-	}
-	if f < float64(low) || f > float64(high) {
-		return high, fmt.Errorf("Temperature must between %d and %d",
-			low, high)
-	}
-	return uint8(f), nil
+	return powerd.Request("reset")
 }
 
 func (i *Info) Hset(args args.Hset, reply *reply.Hset) error {
-	i.mutex.Lock()
-	defer i.mutex.Unlock()
-	v := string(args.Value)
-	v = strings.TrimRight(v, "\n") // Be conservative in what we accept
-
-	switch args.Field {
-	case "fan_tray.speed":
-		if v == "auto" || v == "high" || v == "med" || v == "low" || v == "max" {
-			configuredSpeed = v
-			setSpeed = true
-		} else {
-			return errors.New("Invalid speed")
-		}
-	case "host.temp.units.C":
-		f, err := parseTemp(v, 0, 255)
-		if err != nil {
-			return err
-		}
-		hostTemp = f
-
-	case "host.temp.target.units.C":
-		f, err := parseTemp(v, 25, 85)
-		if err != nil {
-			return err
-		}
-		hostTempTarget = f
-
-	case "qsfp.temp.units.C":
-		f, err := parseTemp(v, 0, 255)
-		if err != nil {
-			return err
-		}
-		qsfpTemp = f
-
-	case "qsfp.temp.target.units.C":
-		f, err := parseTemp(v, 25, 85)
-		if err != nil {
-			return err
-		}
-		qsfpTempTarget = f
-
-	case "fan_tray.speed.return":
-		if v == "" {
-			setSpeed = true
-		}
-
-	case "hwmon.target.units.C":
-		t, err := parseTemp(v, 25, 85)
-		if err != nil {
-			return err
-		}
-
-		if t > 60 {
-			return errors.New("Only integers up to 60 accepted")
-		}
-		hwmTarget = t
-		setHwmTarget = true
-
-	case "host.reset":
-		if v == "true" {
-			hostReset = true
-		}
-	default:
-		return fmt.Errorf("Don't know how to set %s", args.Field)
-	}
-
-	err := i.set(args.Field, v, false)
+	err := i.d.Hset(args.Field, string(args.Value))
 	if err == nil {
 		*reply = 1
 	}
 	return err
-
-}
-
-func (i *Info) set(key, value string, isReadyEvent bool) error {
-	i.pub.Print(key, ": ", value)
-	return nil
 }
 
 func (i *Info) publish(key string, value interface{}) {
-	i.pub.Print(key, ": ", value)
+	i.d.Publish(key, value)
 }
@@ -7,17 +7,19 @@ package main
 import "github.com/platinasystems/goes-bmc/cmd/fantrayd"
 
 func fantraydInit() {
-	fantrayd.Vdev.Bus = 14
-	fantrayd.Vdev.Addr = 0x20
-
-	fantrayd.VpageByKey = map[string]uint8{
-		"fan_tray.1.status": 1,
-		"fan_tray.2.status": 2,
-		"fan_tray.3.status": 3,
-		"fan_tray.4.status": 4,
+	b := currentBoard()
+	if b == nil {
+		return
+	}
+	fantrayd.Vdev.Bus = b.Fantrayd.Bus
+	fantrayd.Vdev.Addr = b.Fantrayd.Addr
+	fantrayd.Vdev.MuxBus = b.Fantrayd.Bus
+	fantrayd.Vdev.MuxAddr = b.Fantrayd.Mux
+	fantrayd.Vdev.MuxValue = b.Fantrayd.MuxValue()
+	fantrayd.Vdev.GpioIntL = b.Fantrayd.GpioIntL
+	fantrayd.VpageByKey = b.Fantrayd.Keys
+	fantrayd.Leds = nil
+	for _, l := range b.Fantrayd.Leds {
+		fantrayd.Leds = append(fantrayd.Leds, fantrayd.LedBits(l))
 	}
-
-	fantrayd.WrRegDv["fantrayd"] = "fantrayd"
-	fantrayd.WrRegFn["fantrayd.example"] = "example"
-	fantrayd.WrRegRng["fantrayd.example"] = []string{"true", "false"}
 }
@@ -1,6 +1,7 @@
 module github.com/platinasystems/goes-bmc
 
 require (
+	github.com/garyburd/redigo v1.6.0
 	github.com/platinasystems/atsock v1.1.0
 	github.com/platinasystems/eeprom v1.0.0
 	github.com/platinasystems/flags v1.0.1
@@ -8,15 +8,28 @@ import (
 	"time"
 
 	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes-bmc/cmd/board"
+	"github.com/platinasystems/goes-bmc/cmd/console"
+	"github.com/platinasystems/goes-bmc/cmd/consoled"
 	"github.com/platinasystems/goes-bmc/cmd/diag"
+	"github.com/platinasystems/goes-bmc/cmd/eventlog"
 	"github.com/platinasystems/goes-bmc/cmd/fantrayd"
 	"github.com/platinasystems/goes-bmc/cmd/fspd"
+	"github.com/platinasystems/goes-bmc/cmd/history"
+	"github.com/platinasystems/goes-bmc/cmd/historyd"
+	"github.com/platinasystems/goes-bmc/cmd/hostapid"
 	"github.com/platinasystems/goes-bmc/cmd/ipcfg"
+	"github.com/platinasystems/goes-bmc/cmd/keys"
 	"github.com/platinasystems/goes-bmc/cmd/ledgpiod"
+	"github.com/platinasystems/goes-bmc/cmd/logfwdd"
 	"github.com/platinasystems/goes-bmc/cmd/mmclog"
 	"github.com/platinasystems/goes-bmc/cmd/mmclogd"
+	"github.com/platinasystems/goes-bmc/cmd/netcfg"
+	"github.com/platinasystems/goes-bmc/cmd/power"
+	"github.com/platinasystems/goes-bmc/cmd/powerd"
 	"github.com/platinasystems/goes-bmc/cmd/qspi"
-	"github.com/platinasystems/goes-bmc/cmd/toggle"
+	"github.com/platinasystems/goes-bmc/cmd/sol"
+	"github.com/platinasystems/goes-bmc/cmd/sold"
 	"github.com/platinasystems/goes-bmc/cmd/ucd9090d"
 	"github.com/platinasystems/goes-bmc/cmd/upgrade"
 	"github.com/platinasystems/goes-bmc/cmd/w83795d"
@@ -65,7 +78,6 @@ import (
 	"github.com/platinasystems/goes/cmd/install"
 	"github.com/platinasystems/goes/cmd/ip"
 	"github.com/platinasystems/goes/cmd/kexec"
-	"github.com/platinasystems/goes/cmd/keys"
 	"github.com/platinasystems/goes/cmd/kill"
 	"github.com/platinasystems/goes/cmd/ldp"
 	"github.com/platinasystems/goes/cmd/ln"
@@ -125,6 +137,10 @@ var Goes = &goes.Goes{
 		"cd":      &cd.Command{},
 		"chmod":   chmod.Command{},
 		"cli":     &cli.Command{},
+		"console": console.Command{},
+		"consoled": &consoled.Command{
+			Init: consoledInit,
+		},
 		"cp":      cp.Command{},
 		"daemons": daemons.Admin,
 		"dhcpcd":  &dhcpcd.Command{},
@@ -152,12 +168,18 @@ var Goes = &goes.Goes{
 		"goes-daemons": &daemons.Server{
 			Init: [][]string{
 				[]string{"redisd"},
+				[]string{"consoled"},
 				[]string{"fantrayd"},
 				[]string{"fspd"},
+				[]string{"historyd"},
+				[]string{"hostapid"},
 				[]string{"i2cd"},
 				[]string{"imx6d"},
 				[]string{"ledgpiod"},
+				[]string{"logfwdd"},
 				[]string{"mmclogd"},
+				[]string{"powerd"},
+				[]string{"sold"},
 				[]string{"sshd"},
 				[]string{"uptimed"},
 				[]string{"ucd9090d"},
@@ -165,18 +187,21 @@ var Goes = &goes.Goes{
 				[]string{"watchdog"},
 			},
 		},
-		"gpio":    gpio.Command{},
-		"grep":    grep.Command{},
-		"hdel":    hdel.Command{},
-		"hdelta":  &hdelta.Command{},
-		"hexists": hexists.Command{},
-		"hget":    hget.Command{},
-		"hgetall": hgetall.Command{},
-		"hkeys":   hkeys.Command{},
-		"hset":    hset.Command{},
-		"i2c":     i2c.Command{},
-		"i2cd":    i2cd.Command{},
-		"if":      &ifcmd.Command{},
+		"gpio":     gpio.Command{},
+		"grep":     grep.Command{},
+		"hdel":     hdel.Command{},
+		"hdelta":   &hdelta.Command{},
+		"hexists":  hexists.Command{},
+		"hget":     hget.Command{},
+		"hgetall":  hgetall.Command{},
+		"history":  history.Command{},
+		"historyd": &historyd.Command{},
+		"hkeys":    hkeys.Command{},
+		"hostapid": &hostapid.Command{},
+		"hset":     hset.Command{},
+		"i2c":      i2c.Command{},
+		"i2cd":     i2cd.Command{},
+		"if":       &ifcmd.Command{},
 		"imx6d": &imx6d.Command{
 			VpageByKey: map[string]uint8{
 				"bmc.temperature.units.C": 1,
@@ -197,6 +222,7 @@ var Goes = &goes.Goes{
 		},
 		"ln":      ln.Command{},
 		"log":     log.Command{},
+		"logfwdd": &logfwdd.Command{},
 		"ls":      ls.Command{},
 		"lsmod":   lsmod.Command{},
 		"lsof":    lsof.Command{},
@@ -205,10 +231,15 @@ var Goes = &goes.Goes{
 		"mmclog":  mmclog.Command{},
 		"mmclogd": &mmclogd.Command{},
 		"mount":   mount.Command{},
+		"netcfg":  netcfg.Command{},
 		"ping":    ping.Command{},
-		"ps":      ps.Command{},
-		"pwd":     pwd.Command{},
-		"reboot":  &reboot.Command{},
+		"power":   power.Command{},
+		"powerd": &powerd.Command{
+			Init: powerdInit,
+		},
+		"ps":     ps.Command{},
+		"pwd":    pwd.Command{},
+		"reboot": &reboot.Command{},
 		"redisd": &redisd.Command{
 			Devs:    []string{"lo", "eth0"},
 			Machine: "platina-mk1-bmc",
@@ -236,10 +267,12 @@ var Goes = &goes.Goes{
 				lang.EnUS: "print stuff",
 			},
 			ByName: map[string]cmd.Cmd{
+				"board":     board.Command{},
 				"buildid":   buildid.Command{},
 				"buildinfo": buildinfo.Command{},
 				"cmdline":   cmdline.Command{},
 				"copyright": License,
+				"events":    eventlog.Command{},
 				"iminfo":    iminfo.Command{},
 				"license":   License,
 				"log":       daemons.Log{},
@@ -248,8 +281,12 @@ var Goes = &goes.Goes{
 				"version":   &version.Command{V: Version},
 			},
 		},
-		"/init":  &slashinit.Command{FsHook: ubiSetup},
-		"sleep":  sleep.Command{},
+		"/init": &slashinit.Command{FsHook: ubiSetup},
+		"sleep": sleep.Command{},
+		"sol":   sol.Command{},
+		"sold": &sold.Command{
+			Init: soldInit,
+		},
 		"source": &source.Command{},
 		"sshd":   &sshd.Command{FailSafe: false},
 		"start": &start.Command{
@@ -264,7 +301,6 @@ var Goes = &goes.Goes{
 		"sync":      sync.Command{},
 		"[":         testcmd.Command{},
 		"then":      &thencmd.Command{},
-		"toggle":    toggle.Command{},
 		"true":      truecmd.Command{},
 		"ubiattach": ubi.AttachCommand{},
 		"ubidetach": ubi.DetachCommand{},
@@ -4,35 +4,23 @@
 
 package main
 
-import (
-	"fmt"
-
-	"github.com/platinasystems/goes-bmc/cmd/ledgpiod"
-	"github.com/platinasystems/goes/external/redis"
-)
+import "github.com/platinasystems/goes-bmc/cmd/ledgpiod"
 
 func ledgpiodInit() {
-	ledgpiod.VpageByKey = map[string]uint8{
-		"system.fan_direction": 0,
+	b := currentBoard()
+	if b == nil {
+		return
 	}
-	ver := 0
-	ledgpiod.Vdev.Bus = 5
-	ledgpiod.Vdev.Addr = 0x75
-	s, err := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
-	if err != nil {
-		ledgpiod.Vdev.Addr = 0x75
-	} else {
-		_, _ = fmt.Sscan(s, &ver)
-		switch ver {
-		case 0xff:
-			ledgpiod.Vdev.Addr = 0x22
-		case 0x00:
-			ledgpiod.Vdev.Addr = 0x22
-		default:
-			ledgpiod.Vdev.Addr = 0x75
-		}
+	ledgpiod.Vdev.Bus = b.Ledgpiod.Bus
+	ledgpiod.Vdev.Addr = b.Ledgpiod.Addr
+	ledgpiod.Vdev.MuxBus = b.Ledgpiod.Bus
+	ledgpiod.Vdev.MuxAddr = b.Ledgpiod.Mux
+	ledgpiod.Vdev.MuxValue = b.Ledgpiod.MuxValue()
+	ledgpiod.VpageByKey = b.Ledgpiod.Keys
+	ledgpiod.SysLed = ledgpiod.LedBits(b.Ledgpiod.System)
+	ledgpiod.FanLed = ledgpiod.LedBits(b.Ledgpiod.Fan)
+	ledgpiod.PsuLed = nil
+	for _, l := range b.Ledgpiod.Psu {
+		ledgpiod.PsuLed = append(ledgpiod.PsuLed, ledgpiod.LedBits(l))
 	}
-	ledgpiod.WrRegDv["ledgpiod"] = "ledgpiod"
-	ledgpiod.WrRegFn["ledgpiod.example"] = "example"
-	ledgpiod.WrRegRng["ledgpiod.example"] = []string{"true", "false"}
 }
@@ -0,0 +1,23 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import "github.com/platinasystems/goes-bmc/cmd/powerd"
+
+func powerdInit() {
+	b := currentBoard()
+	if b == nil {
+		return
+	}
+	var pins []string
+	for _, p := range b.Fspd.Psu {
+		if p.GpioPwronL != "" {
+			pins = append(pins, p.GpioPwronL)
+		}
+	}
+	if len(pins) > 0 {
+		powerd.GpioPwronL = pins
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import "github.com/platinasystems/goes-bmc/cmd/sold"
+
+func soldInit() {
+	b := currentBoard()
+	if b == nil {
+		return
+	}
+	sold.Tty = b.Sold.Tty
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/platinasystems/goes-bmc/cmd/consoled"
 	"github.com/platinasystems/goes/external/redis"
 	"github.com/platinasystems/gpio"
 	"github.com/platinasystems/log"
@@ -19,8 +20,6 @@ const (
 )
 
 func startConfGpioHook() error {
-	var deviceVer byte
-
 	pin, found := gpio.FindPin("QSPI_MUX_SEL")
 	if found {
 		r, _ := pin.Value()
@@ -58,13 +57,8 @@ func startConfGpioHook() error {
 	redis.Hwait(redis.DefaultHash, "redis.ready", "true",
 		10*time.Second)
 
-	ss, _ := redis.Hget(redis.DefaultHash, "eeprom.DeviceVersion")
-	_, _ = fmt.Sscan(ss, &deviceVer)
-	if deviceVer == 0x0 || deviceVer == 0xff {
-		pin, found = gpio.FindPin("FP_BTN_UARTSEL_EN_L")
-		if found {
-			pin.SetValue(false)
-		}
+	if b := currentBoard(); b != nil && b.ConsoleButton {
+		consoled.SetButton(true)
 	}
 	return nil
 }
@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"os"
 	"path"
 	"strconv"
@@ -16,6 +15,7 @@ import (
 	"syscall"
 	"unsafe"
 
+	"github.com/platinasystems/goes-bmc/cmd/netcfg"
 	"github.com/platinasystems/gpio"
 	"github.com/platinasystems/mtd"
 	"github.com/platinasystems/ubi"
@@ -187,6 +187,17 @@ func ubiSetup() (err error) {
 					err)
 			}
 		}
+		_, err = os.Stat(netcfg.ConfigFile)
+		if os.IsNotExist(err) {
+			c := netcfg.ParseLegacy(perNoNul)
+			if err = c.Validate(); err == nil {
+				err = c.Store()
+			}
+			if err != nil {
+				fmt.Printf("Error saving network config: %s\n",
+					err)
+			}
+		}
 		verDev, err := mtd.NameToUnit("ver")
 		if err != nil {
 			return err
@@ -307,37 +318,5 @@ func ubiSetup() (err error) {
 }
 
 func ipCommand(per string) []byte {
-	ipS := strings.Split(per, ":")
-	outstr := ""
-
-	if len(ipS) > 0 {
-		clientIP := ipS[0]
-		if clientIP == "dhcp" {
-			outstr += "daemons start dhcpcd\n"
-		} else {
-			if len(ipS) > 3 {
-				netmaskIP := net.ParseIP(ipS[3])
-				if netmaskIP != nil {
-					nm := netmaskIP.To4()
-					if nm != nil {
-						mask := net.IPv4Mask(nm[0], nm[1],
-							nm[2], nm[3])
-						ones, bits := mask.Size()
-						if bits == net.IPv4len*8 {
-							clientIP = clientIP + "/" +
-								strconv.Itoa(ones)
-						}
-					}
-				}
-			}
-			outstr += fmt.Sprintf(`ip link eth0 change up
-ip address add %s dev eth0
-`,
-				clientIP)
-		}
-	}
-	if len(ipS) > 2 {
-		outstr += fmt.Sprintf("ip route add 0.0.0.0/0 via %s\n", ipS[2])
-	}
-	return []byte(outstr)
+	return netcfg.ParseLegacy(per).Script()
 }
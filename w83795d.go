@@ -7,35 +7,14 @@ package main
 import "github.com/platinasystems/goes-bmc/cmd/w83795d"
 
 func w83795dInit() {
-	w83795d.Vdev.Bus = 11
-	w83795d.Vdev.Addr = 0x2f
-
-	w83795d.VpageByKey = map[string]uint8{
-		"fan_tray.1.1.speed.units.rpm": 1,
-		"fan_tray.1.2.speed.units.rpm": 2,
-		"fan_tray.2.1.speed.units.rpm": 3,
-		"fan_tray.2.2.speed.units.rpm": 4,
-		"fan_tray.3.1.speed.units.rpm": 5,
-		"fan_tray.3.2.speed.units.rpm": 6,
-		"fan_tray.4.1.speed.units.rpm": 7,
-		"fan_tray.4.2.speed.units.rpm": 8,
-		"fan_tray.speed":               0,
-		"fan_tray.duty":                0,
-		"hwmon.front.temp.units.C":     0,
-		"hwmon.rear.temp.units.C":      0,
-		"hwmon.target.units.C":         0,
-		"host.temp.units.C":            0,
-		"host.temp.target.units.C":     0,
-		"qsfp.temp.units.C":            0,
-		"qsfp.temp.target.units.C":     0,
+	b := currentBoard()
+	if b == nil {
+		return
 	}
-
-	w83795d.WrRegDv["fan_tray"] = "fan_tray"
-
-	w83795d.WrRegDv["host"] = "host"
-
-	w83795d.WrRegDv["qsfp"] = "qsfp"
-
-	w83795d.WrRegDv["hwmon"] = "hwmon"
-
+	w83795d.Vdev.Bus = b.W83795d.Bus
+	w83795d.Vdev.Addr = b.W83795d.Addr
+	w83795d.Vdev.MuxBus = b.W83795d.Bus
+	w83795d.Vdev.MuxAddr = b.W83795d.Mux
+	w83795d.Vdev.MuxValue = b.W83795d.MuxValue()
+	w83795d.VpageByKey = b.W83795d.Keys
 }